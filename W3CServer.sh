@@ -2,6 +2,8 @@
 
 services=(server_core service_mgr at_server agt_server http_mgr ws_mgr mqtt_mgr)
 
+export VISSV2_CONFIG=$PWD/server/vissv2config.json
+
 usage() {
 	#    echo "usage: $0 startme|stopme|configureme" >&2
 	echo "usage: $0 startme|stopme" >&2
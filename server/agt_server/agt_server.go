@@ -62,10 +62,10 @@ func makeAgtServerHandler(serverChannel chan string) func(http.ResponseWriter, *
 }
 
 func initAgtServer(serverChannel chan string, muxServer *http.ServeMux) {
-	utils.Info.Printf("initAtServer(): :7500/agtserver")
+	utils.Info.Printf("initAgtServer(): :%d/agtserver", utils.Config.Ports.AgtServer)
 	agtServerHandler := makeAgtServerHandler(serverChannel)
 	muxServer.HandleFunc("/agtserver", agtServerHandler)
-	utils.Error.Fatal(http.ListenAndServe(":7500", muxServer))
+	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(utils.Config.Ports.AgtServer), muxServer))
 }
 
 func generateResponse(input string) string {
@@ -73,12 +73,12 @@ func generateResponse(input string) string {
 	err := json.Unmarshal([]byte(input), &payload)
 	if err != nil {
 		utils.Error.Printf("generateResponse:error input=%s", input)
-		return `{"error": "Client request malformed"}`
+		return utils.ErrorResponse(utils.ErrBadRequest, "Client request malformed.")
 	}
 	if authenticateClient(payload) == true {
 		return generateAgt(payload)
 	}
-	return `{"error": "Client authentication failed"}`
+	return utils.ErrorResponse(utils.ErrForbiddenRequest, "Client authentication failed.")
 }
 
 func checkUserRole(userRole string) bool {
@@ -126,7 +126,7 @@ func generateAgt(payload Payload) string {
 	uuid, err := exec.Command("uuidgen").Output()
 	if err != nil {
 		utils.Error.Printf("generateAgt:Error generating uuid, err=%s", err)
-		return `{"error": "Internal error"}`
+		return utils.ErrorResponse(utils.ErrServiceUnavailable, "Access grant token could not be generated.")
 	}
 	uuid = uuid[:len(uuid)-1] // remove '\n' char
 	iat := int(time.Now().Unix())
@@ -159,6 +159,7 @@ func main() {
 		Required: false,
 		Help:     "changes log output level",
 		Default:  "info"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -167,15 +168,20 @@ func main() {
 	}
 
 	utils.InitLog("agtserver-log.txt", "./logs", *logFile, *logLevel)
+	utils.InitConfig(*configFile)
 	serverChan := make(chan string)
 	muxServer := http.NewServeMux()
 
 	go initAgtServer(serverChan, muxServer)
+	go utils.ServeMetrics(utils.Config.MetricsPorts.AgtServer)
 
 	for {
 		select {
 		case request := <-serverChan:
+			start := time.Now()
 			response := generateResponse(request)
+			_, result := utils.MessageResult(response)
+			utils.ObserveRequestResult("access_grant_token", result, start)
 			utils.Info.Printf("agtServer response=%s", response)
 			serverChan <- response
 		}
@@ -19,28 +19,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unsafe"
 
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
 	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
 	"github.com/akamensky/argparse"
 )
 
-// #include <stdlib.h>
-// #include <stdint.h>
-// #include <stdio.h>
-// #include <stdbool.h>
-// #include "cparserlib.h"
-import "C"
-
-var VSSTreeRoot C.long
-
-// set to MAXFOUNDNODES in cparserlib.h
-const MAXFOUNDNODES = 1500
-
-type searchData_t struct { // searchData_t defined in cparserlib.h
-	path            [512]byte // cparserlib.h: #define MAXCHARSPATH 512; typedef char path_t[MAXCHARSPATH];
-	foundNodeHandle int64     // defined as long in cparserlib.h
-}
+var VSSTreeRoot *treemgr.Node_t
 
 const theAgtSecret = "averysecretkeyvalue1" //shared with agt-server
 const theAtSecret = "averysecretkeyvalue2"  //not shared
@@ -105,14 +90,12 @@ type ScopeElement struct {
 	NoAccess []string
 }
 
-func initVssFile() bool {
-	filePath := "vss_vissv2.binary"
-	cfilePath := C.CString(filePath)
-	VSSTreeRoot = C.VSSReadTree(cfilePath)
-	C.free(unsafe.Pointer(cfilePath))
+func initVssFile(treeFormat string, overlayFnames []string) bool {
+	var err error
+	VSSTreeRoot, err = treemgr.ReadTree("vss_vissv2."+treeFormat, overlayFnames)
 
-	if VSSTreeRoot == 0 {
-		utils.Error.Println("Tree file not found")
+	if VSSTreeRoot == nil {
+		utils.Error.Printf("initVssFile():%s", err)
 		return false
 	}
 
@@ -148,52 +131,37 @@ func makeAtServerHandler(serverChannel chan string) func(http.ResponseWriter, *h
 }
 
 func initAtServer(serverChannel chan string, muxServer *http.ServeMux) {
-	utils.Info.Printf("initAtServer(): :8600/atserver")
+	utils.Info.Printf("initAtServer(): :%d/atserver", utils.Config.Ports.AtServer)
 	atServerHandler := makeAtServerHandler(serverChannel)
 	muxServer.HandleFunc("/atserver", atServerHandler)
-	utils.Error.Fatal(http.ListenAndServe(":8600", muxServer))
+	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(utils.Config.Ports.AtServer), muxServer))
 }
 
 func generateResponse(input string) string {
+	start := time.Now()
 	if strings.Contains(input, "purpose") == true {
-		return accessTokenResponse(input)
+		response := accessTokenResponse(input)
+		_, result := utils.MessageResult(response)
+		utils.ObserveRequestResult("access_token", result, start)
+		return response
 	} else if strings.Contains(input, "context") == true {
-		return noScopeResponse(input)
+		response := noScopeResponse(input)
+		utils.ObserveRequestResult("no_access_scope", "ok", start)
+		return response
 	} else {
-		return tokenValidationResponse(input)
-	}
-}
-
-func getPathLen(path string) int {
-	for i := 0; i < len(path); i++ {
-		if path[i] == 0x00 { // the path buffer defined in searchData_t is initiated with all zeros
-			return i
-		}
+		response, validation := tokenValidationResponse(input)
+		utils.CountTokenValidation(validation)
+		utils.ObserveRequestResult("token_validation", utils.TokenValidationResult(validation), start)
+		return response
 	}
-	return len(path)
 }
 
 func validateRequestAccess(scope string, action string, paths []string) int {
 	numOfPaths := len(paths)
 	var pathSubList []string
 	for i := 0; i < numOfPaths; i++ {
-		numOfWildcardPaths := 1
-		if strings.Contains(paths[i], "*") == true {
-			searchData := [MAXFOUNDNODES]searchData_t{}
-			// call int VSSSearchNodes(char* searchPath, long rootNode, int maxFound, searchData_t* searchData, bool anyDepth, bool leafNodesOnly, int listSize, noScopeList_t* noScopeList, int* validation);
-			cpath := C.CString(paths[i])
-			numOfWildcardPaths := int(C.VSSSearchNodes(cpath, VSSTreeRoot, MAXFOUNDNODES, (*C.struct_searchData_t)(unsafe.Pointer(&searchData)), true, true, 0, nil, nil))
-			C.free(unsafe.Pointer(cpath))
-			pathSubList = make([]string, numOfWildcardPaths)
-			for j := 0; j < numOfWildcardPaths; j++ {
-				pathLen := getPathLen(string(searchData[j].path[:]))
-				pathSubList[j] = string(searchData[j].path[:pathLen])
-			}
-		} else {
-			pathSubList = make([]string, 1)
-			pathSubList[0] = paths[i]
-		}
-		for j := 0; j < numOfWildcardPaths; j++ {
+		pathSubList = treemgr.ExpandWildcardPath(VSSTreeRoot, paths[i])
+		for j := 0; j < len(pathSubList); j++ {
 			status := validateScopeAndAccessMode(scope, action, pathSubList[j])
 			if status != 0 {
 				return status
@@ -209,7 +177,7 @@ func validateScopeAndAccessMode(scope string, action string, path string) int {
 			for j := 0; j < len(pList[i].Access); j++ {
 				if pList[i].Access[j].Path == path {
 					if action == "set" && pList[i].Access[j].Mode == "read-only" {
-						return -16
+						return -8 // insufficient access mode, see getTokenErrorMessage() in the server core
 					} else {
 						return 0
 					}
@@ -217,7 +185,7 @@ func validateScopeAndAccessMode(scope string, action string, path string) int {
 			}
 		}
 	}
-	return -8
+	return -4 // invalid purpose scope
 }
 
 func matchingContext(index int, context string) bool { // identical to checkAuthorization(), using sList instead of pList
@@ -273,26 +241,29 @@ func noScopeResponse(input string) string {
 	return `{"no_access":` + res + `}`
 }
 
-func tokenValidationResponse(input string) string {
+/**
+* tokenValidationResponse returns the validation response, and the validation code it contains.
+**/
+func tokenValidationResponse(input string) (string, int) {
 	var inputMap map[string]interface{}
 	err := json.Unmarshal([]byte(input), &inputMap)
 	if err != nil {
 		utils.Error.Printf("tokenValidationResponse:error input=%s", input)
-		return `{"validation":"-128"}`
+		return `{"validation":"-128"}`, -128
 	}
 	var atValidatePayload AtValidatePayload
 	extractAtValidatePayloadLevel1(inputMap, &atValidatePayload)
 	if utils.VerifyTokenSignature(atValidatePayload.Token, theAtSecret) == false {
 		utils.Info.Printf("tokenValidationResponse:invalid signature=%s", atValidatePayload.Token)
-		return `{"validation":"-2"}`
+		return `{"validation":"-2"}`, -2
 	}
 	scope := utils.ExtractFromToken(atValidatePayload.Token, "scp")
 	res := validateRequestAccess(scope, atValidatePayload.Action, atValidatePayload.Paths)
 	if res != 0 {
 		utils.Info.Printf("validateRequestAccess fails with result=%d", res)
-		return `{"validation":"` + strconv.Itoa(res) + `"}`
+		return `{"validation":"` + strconv.Itoa(res) + `"}`, res
 	}
-	return `{"validation":"0"}`
+	return `{"validation":"0"}`, 0
 }
 
 func extractAtValidatePayloadLevel1(atValidateMap map[string]interface{}, atValidatePayload *AtValidatePayload) {
@@ -339,7 +310,7 @@ func accessTokenResponse(input string) string {
 	err := json.Unmarshal([]byte(input), &payload)
 	if err != nil {
 		utils.Error.Printf("accessTokenResponse:error input=%s", input)
-		return `{"error": "Client request malformed"}`
+		return utils.ErrorResponse(utils.ErrBadRequest, "Client request malformed.")
 	}
 	agToken, errResp := extractTokenPayload(payload.Token)
 	if len(errResp) > 0 {
@@ -429,7 +400,7 @@ func extractTokenPayload(token string) (AgToken, string) {
 	err := json.Unmarshal([]byte(tokenPayload), &agToken)
 	if err != nil {
 		utils.Error.Printf("extractTokenPayload:token payload=%s, error=%s", tokenPayload, err)
-		return agToken, `{"error": "AG token malformed"}`
+		return agToken, utils.ErrorResponse(utils.ErrInvalidToken, "AG token malformed.")
 	}
 	return agToken, ""
 }
@@ -441,23 +412,23 @@ func checkVin(vin string) bool {
 func validateRequest(payload AtGenPayload, agToken AgToken) (bool, string) {
 	if checkVin(agToken.Vin) == false {
 		utils.Info.Printf("validateRequest:incorrect VIN=%s", agToken.Vin)
-		return false, `{"error": "Incorrect vehicle identifiction"}`
+		return false, utils.ErrorResponse(utils.ErrForbiddenRequest, "Incorrect vehicle identification.")
 	}
 	if utils.VerifyTokenSignature(payload.Token, theAgtSecret) == false {
 		utils.Info.Printf("validateRequest:invalid signature=%s", payload.Token)
-		return false, `{"error": "AG token signature validation failed"}`
+		return false, utils.ErrorResponse(utils.ErrInvalidToken, "AG token signature validation failed.")
 	}
 	if validateTokenTimestamps(agToken.Iat, agToken.Exp) == false {
 		utils.Info.Printf("validateRequest:invalid token timestamps, iat=%d, exp=%d", agToken.Iat, agToken.Exp)
-		return false, `{"error": "AG token timestamp validation failed"}`
+		return false, utils.ErrorResponse(utils.ErrInvalidToken, "AG token timestamp validation failed.")
 	}
 	if len(agToken.Key) != 0 && payload.Pop != "GHI" { // PoP should be a signed timestamp
 		utils.Info.Printf("validateRequest:Proof of possession of key pair failed")
-		return false, `{"error": "Proof of possession of key pair failed"}`
+		return false, utils.ErrorResponse(utils.ErrInvalidToken, "Proof of possession of key pair failed.")
 	}
 	if validatePurpose(payload.Purpose, agToken.Context) == false {
 		utils.Info.Printf("validateRequest:invalid purpose=%s, context=%s", payload, agToken.Context)
-		return false, `{"error": "Purpose validation failed"}`
+		return false, utils.ErrorResponse(utils.ErrForbiddenRequest, "Purpose validation failed.")
 	}
 	return true, ""
 }
@@ -466,7 +437,7 @@ func generateAt(payload AtGenPayload, context string) string {
 	uuid, err := exec.Command("uuidgen").Output()
 	if err != nil {
 		utils.Error.Printf("generateAt:Error generating uuid, err=%s", err)
-		return `{"error": "Internal error"}`
+		return utils.ErrorResponse(utils.ErrServiceUnavailable, "Access token could not be generated.")
 	}
 	uuid = uuid[:len(uuid)-1] // remove '\n' char
 	iat := int(time.Now().Unix())
@@ -795,6 +766,9 @@ func main() {
 		Required: false,
 		Help:     "changes log output level",
 		Default:  "info"})
+	treeFormat := parser.Selector("", "treeformat", []string{"binary", "json"}, &argparse.Options{Required: false, Help: "VSS tree file format, vss_vissv2.binary or vss_vissv2.json is read", Default: "binary"})
+	overlays := parser.List("", "overlay", &argparse.Options{Required: false, Help: "VSS overlay file applied to the tree, may be repeated"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -806,11 +780,15 @@ func main() {
 	muxServer := http.NewServeMux()
 
 	utils.InitLog("atserver-log.txt", "./logs", *logFile, *logLevel)
+	utils.InitConfig(*configFile)
 	initPurposelist()
 	initScopeList()
-	initVssFile()
+	if !initVssFile(*treeFormat, *overlays) {
+		utils.Error.Fatal(" Tree file could not be read")
+	}
 
 	go initAtServer(serverChan, muxServer)
+	go utils.ServeMetrics(utils.Config.MetricsPorts.AtServer)
 
 	for {
 		select {
@@ -42,14 +42,17 @@ func main() {
         payLoad := ""
         switch command[0] {
           case 'c': fallthrough
-          case 'C':  // {"action":"create", "path": X, "buf-size":"Y"}
+          case 'C':  // {"action":"create", "path": X, "buf-size":"Y", "max-age":"A"}
               var path string
               var bufSize string
+              var maxAge string
               fmt.Printf("Path=")
               fmt.Scanf("%s\n", &path)
               fmt.Printf("Buffer size=")
               fmt.Scanf("%s\n", &bufSize)
-              payLoad = `{"action": "create", "path":"` + path + `", "buf-size":"` + bufSize + `"}`
+              fmt.Printf("Max age (secs, 0 for no max)=")
+              fmt.Scanf("%s\n", &maxAge)
+              payLoad = `{"action": "create", "path":"` + path + `", "buf-size":"` + bufSize + `", "max-age":"` + maxAge + `"}`
           case 's': fallthrough
           case 'S':  // {"action":"start", "path": X, "frequency":"Z"}
               var path string
@@ -39,6 +39,7 @@ func main() {
 		Required: false,
 		Help:     "changes log output level",
 		Default:  "info"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -48,9 +49,11 @@ func main() {
 
 	utils.TransportErrorMessage = "HTTP transport mgr-finalizeResponse: JSON encode failed.\n"
 	utils.InitLog("http-mgr-log.txt", "./logs", *logFile, *logLevel)
+	utils.InitConfig(*configFile)
 
 	regData := utils.RegData{}
 	utils.RegisterAsTransportMgr(&regData, "HTTP")
+	go utils.ServeMetrics(utils.Config.MetricsPorts.HttpMgr)
 
 	utils.ReadTransportSecConfig()
 
@@ -40,6 +40,11 @@ type TopicList struct {
 
 var topicList TopicList
 
+type PendingRequest struct { // request waiting for its response, for the request metrics
+	request string
+	start   time.Time
+}
+
 func vissV2Receiver(dataConn *websocket.Conn, vissv2Channel chan string) {
 	defer dataConn.Close()
 	for {
@@ -212,6 +217,7 @@ func main() {
 		Required: false,
 		Help:     "changes log output level",
 		Default:  "info"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -221,9 +227,11 @@ func main() {
 
 	utils.TransportErrorMessage = "MQTT transport mgr-finalizeResponse: JSON encode failed.\n"
 	utils.InitLog("mqtt-mgr-log.txt", "./logs", *logFile, *logLevel)
+	utils.InitConfig(*configFile)
 
 	regData := utils.RegData{}
 	utils.RegisterAsTransportMgr(&regData, "MQTT")
+	go utils.ServeMetrics(utils.Config.MetricsPorts.MqttMgr)
 
 	mqttChannel = make(chan string)
 	vissv2Channel := make(chan string)
@@ -234,6 +242,7 @@ func main() {
 	serverSubscription := mqttSubscribe(brokerSocket, getVissV2Topic(dataConn, regData))
 	topicId := 0
 	topicList.nodes = 0
+	pendingRequests := map[int]PendingRequest{} // key is topicId
 
 	go vissV2Receiver(dataConn, vissv2Channel) //message reception from server core
 
@@ -249,9 +258,11 @@ func main() {
 			// add mgrId + clientId=0 to message, forward to server core
 			newPrefix := "{\"RouterId\":\"" + strconv.Itoa(regData.Mgrid) + "?" + strconv.Itoa(topicId) + "\", "
 			request := strings.Replace(payload, "{", newPrefix, 1)
+			pendingRequests[topicId] = PendingRequest{payload, time.Now()}
 			err := dataConn.WriteMessage(websocket.TextMessage, []byte(request)) // send request to server core
 			if err != nil {
 				utils.Error.Println("Datachannel write error:" + err.Error())
+				delete(pendingRequests, topicId) // no response will be received
 			}
 			topicId++
 
@@ -259,6 +270,12 @@ func main() {
 			utils.Info.Printf("MQTT hub: Message from VISSv2 server:%s\n", vissv2Message)
 			// link routerId to topic, remove routerId from message, create mqtt message, send message to mqtt transport
 			payload, topicHandle := utils.RemoveInternalData(string(vissv2Message))
+			if pending, ok := pendingRequests[topicHandle]; ok {
+				utils.ObserveRequest(pending.request, payload, pending.start)
+				delete(pendingRequests, topicHandle)
+			} else {
+				utils.CountNotification()
+			}
 			publishMessage(brokerSocket, getTopic(topicHandle), payload)
 
 		default:
@@ -0,0 +1,239 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Admin server:
+* A local HTTP server for operators, only reachable from the host the server core runs on.
+* GET /admin/status returns the registered transport and service managers, the service routing, the request counters,
+* the number of subscriptions, clients, and pending requests, and the loaded VSS tree.
+* POST /admin/reload reloads the VSS tree, POST /admin/drain makes the server core reject new requests, and POST /admin/resume ends the draining.
+* The routing state is owned by the server hub, so it is requested from the hub via hubStatusChan.
+**/
+
+var adminPortNum int = 8090 // 0 disables the admin server, set from the configuration at startup
+
+var draining int32 // 1 while draining, accessed atomically by the request workers and the admin server
+
+var hubStatusChan = make(chan chan HubStatus_t)
+
+type AdminTransportMgr_t struct {
+	MgrId         int    `json:"mgrId"`
+	MgrIndex      int    `json:"mgrIndex"`
+	Protocol      string `json:"protocol"`
+	PortNum       int    `json:"portNum"`
+	Requests      uint64 `json:"requests"`
+	Messages      uint64 `json:"messages"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+type AdminService_t struct {
+	ServiceIndex int    `json:"serviceIndex"`
+	RootNode     string `json:"rootNode"`
+	RemoteIp     string `json:"remoteIp"`
+	PortNum      int    `json:"portNum"`
+	Connected    bool   `json:"connected"`
+}
+
+type AdminRoute_t struct {
+	RootNode     string `json:"rootNode"`
+	ServiceIndex int    `json:"serviceIndex"`
+}
+
+type AdminTree_t struct {
+	File     string   `json:"file"`
+	Overlays []string `json:"overlays"`
+	Version  string   `json:"version"` // from the VersionVSS branch, empty if not set in the tree
+	Modified string   `json:"modified"`
+	Loaded   string   `json:"loaded"`
+	Reloads  int      `json:"reloads"`
+}
+
+type AdminStatus_t struct {
+	Draining        bool                  `json:"draining"`
+	TransportMgrs   []AdminTransportMgr_t `json:"transportMgrs"`
+	Services        []AdminService_t      `json:"services"`
+	ServiceRouting  []AdminRoute_t        `json:"serviceRouting"`
+	Subscriptions   int                   `json:"subscriptions"`
+	Clients         int                   `json:"clients"`
+	PendingRequests int                   `json:"pendingRequests"`
+	Tree            AdminTree_t           `json:"tree"`
+}
+
+/**
+* HubStatus_t is the part of the admin status that is owned by the server hub.
+**/
+type HubStatus_t struct {
+	routes           []AdminRoute_t
+	connected        map[int]bool
+	mgrSubscriptions map[int]int // number of subscriptions per transport mgr ID
+	subscriptions    int
+	clients          int // clients having subscriptions or pending requests
+	pendingRequests  int
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+func setDraining(isDraining bool) {
+	var value int32
+	if isDraining {
+		value = 1
+	}
+	atomic.StoreInt32(&draining, value)
+	utils.Info.Printf("setDraining():draining=%t", isDraining)
+}
+
+/**
+* getHubStatus is called by the server hub.
+**/
+func getHubStatus() HubStatus_t {
+	status := HubStatus_t{routes: []AdminRoute_t{}}
+	for _, route := range serviceRouting {
+		status.routes = append(status.routes, AdminRoute_t{route.rootNode, route.serviceIndex})
+	}
+	status.connected = make(map[int]bool)
+	for serviceIndex, isConnected := range serviceConnected {
+		status.connected[serviceIndex] = isConnected
+	}
+	status.mgrSubscriptions = make(map[int]int)
+	clients := map[string]bool{}
+	for _, subscription := range coreSubscriptionList {
+		status.mgrSubscriptions[extractMgrId(subscription.routerId)]++
+		clients[subscription.routerId] = true
+	}
+	for _, pending := range pendingRequests {
+		if !pending.isInternal && len(pending.routerId) > 0 {
+			clients[pending.routerId] = true
+		}
+	}
+	status.subscriptions = len(coreSubscriptionList)
+	status.clients = len(clients)
+	status.pendingRequests = len(pendingRequests)
+	return status
+}
+
+/**
+* getTreeVersion returns the version from the VersionVSS attributes of the tree, or an empty string if they have no values.
+**/
+func getTreeVersion(root *treemgr.Node_t) string {
+	version := ""
+	for _, name := range []string{"Major", "Minor", "Patch"} {
+		matches, searchData := treemgr.SearchNodes(root, root.Name+".VersionVSS."+name, false, true, 0, nil, nil)
+		if matches != 1 || len(searchData[0].NodeHandle.DefaultEnum) == 0 {
+			return ""
+		}
+		version += searchData[0].NodeHandle.DefaultEnum + "."
+	}
+	return version[:len(version)-1]
+}
+
+func getAdminStatus() AdminStatus_t {
+	statusChan := make(chan HubStatus_t)
+	hubStatusChan <- statusChan
+	hubStatus := <-statusChan
+
+	status := AdminStatus_t{Draining: isDraining(), ServiceRouting: hubStatus.routes} // empty lists are returned as [], not null
+	status.TransportMgrs = []AdminTransportMgr_t{}
+	status.Services = []AdminService_t{}
+	status.Subscriptions = hubStatus.subscriptions
+	status.Clients = hubStatus.clients
+	status.PendingRequests = hubStatus.pendingRequests
+
+	transportMgrMutex.RLock()
+	for _, mgr := range transportMgrs {
+		status.TransportMgrs = append(status.TransportMgrs, AdminTransportMgr_t{mgr.mgrId, mgr.mgrIndex, mgr.protocol, mgr.portNum,
+			atomic.LoadUint64(&mgr.requestCount), atomic.LoadUint64(&mgr.messageCount), hubStatus.mgrSubscriptions[mgr.mgrId]})
+	}
+	transportMgrMutex.RUnlock()
+	sort.Slice(status.TransportMgrs, func(i, j int) bool { return status.TransportMgrs[i].MgrIndex < status.TransportMgrs[j].MgrIndex })
+
+	registeredServicesMutex.Lock()
+	for serviceIndex, service := range registeredServices {
+		status.Services = append(status.Services, AdminService_t{serviceIndex, service.rootNode, service.remoteIp,
+			serviceDataPortNum + serviceIndex, hubStatus.connected[serviceIndex]})
+	}
+	registeredServicesMutex.Unlock()
+
+	vssTreeMutex.RLock()
+	root := VSSTreeRoot
+	status.Tree = AdminTree_t{File: vssTreeFname, Overlays: vssOverlayFnames, Loaded: vssTreeLoadTime.UTC().Format(time.RFC3339), Reloads: vssTreeReloads}
+	vssTreeMutex.RUnlock()
+	status.Tree.Version = getTreeVersion(root)
+	status.Tree.Modified = treeModTime().UTC().Format(time.RFC3339)
+	return status
+}
+
+func writeAdminResponse(w http.ResponseWriter, status int, response interface{}) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "500 "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func makeAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/status", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			http.Error(w, "405 method not allowed.", 405)
+			return
+		}
+		writeAdminResponse(w, 200, getAdminStatus())
+	})
+	mux.HandleFunc("/admin/reload", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(w, "405 method not allowed.", 405)
+			return
+		}
+		utils.Info.Printf("adminServer():tree reload requested")
+		if err := reloadVssTree(); err != nil {
+			writeAdminResponse(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		writeAdminResponse(w, 200, map[string]string{"result": "reloaded"})
+	})
+	for _, control := range []string{"drain", "resume"} {
+		isDrain := control == "drain"
+		mux.HandleFunc("/admin/"+control, func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != "POST" {
+				http.Error(w, "405 method not allowed.", 405)
+				return
+			}
+			setDraining(isDrain)
+			writeAdminResponse(w, 200, map[string]bool{"draining": isDrain})
+		})
+	}
+	return mux
+}
+
+func initAdminServer() {
+	if adminPortNum == 0 {
+		return
+	}
+	address := "127.0.0.1:" + strconv.Itoa(adminPortNum) // local access only
+	utils.Info.Printf("initAdminServer(): %s/admin", address)
+	utils.Error.Fatal(http.ListenAndServe(address, makeAdminHandler()))
+}
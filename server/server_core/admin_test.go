@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestAdminDrain(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+	handler := makeAdminHandler()
+	adminRequest := func(method string, path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder.Code
+	}
+	if code := adminRequest("GET", "/admin/drain"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET drain returned %d", code)
+	}
+	if code := adminRequest("POST", "/admin/drain"); code != 200 || !isDraining() {
+		t.Fatalf("drain failed, code=%d", code)
+	}
+	defer setDraining(false)
+
+	serveRequest(`{"RouterId":"4711?1", "action":"get", "path":"Vehicle.Speed", "requestId":"1"}`, mgr.mgrId)
+	var responseMap = make(map[string]interface{})
+	utils.MapRequest(<-mgr.backendChan, &responseMap)
+	if errorMap, ok := responseMap["error"].(map[string]interface{}); !ok || errorMap["reason"] != "service_unavailable" {
+		t.Errorf("request not rejected while draining, response=%v", responseMap)
+	}
+	serveRequest(`{"RouterId":"4711?1", "action":"unsubscribe", "subscriptionId":"1", "requestId":"2"}`, mgr.mgrId)
+	if hubRequest := <-hubRequestChan; hubRequest.requestMap["action"] != "unsubscribe" {
+		t.Errorf("unsubscribe request not forwarded to the hub while draining")
+	}
+
+	if code := adminRequest("POST", "/admin/resume"); code != 200 || isDraining() {
+		t.Errorf("resume failed, code=%d", code)
+	}
+}
+
+func TestGetHubStatus(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+	coreSubscriptionList = []CoreSubscription_t{{subscriptionId: 1, routerId: "4711?1"}, {subscriptionId: 2, routerId: "4711?2"}, {subscriptionId: 3, routerId: "42?1"}}
+	addPendingRequest(map[string]interface{}{"RouterId": "4711?3", "action": "get"}, []int{0}, 0, false)
+	addPendingRequest(map[string]interface{}{"RouterId": "4711?1", "action": "unsubscribe"}, []int{0}, 0, true)
+
+	status := getHubStatus()
+	if status.subscriptions != 3 || status.pendingRequests != 2 {
+		t.Errorf("subscriptions=%d, pendingRequests=%d", status.subscriptions, status.pendingRequests)
+	}
+	if status.clients != 4 {
+		t.Errorf("clients=%d, expected 4", status.clients)
+	}
+	if status.mgrSubscriptions[4711] != 2 || status.mgrSubscriptions[42] != 1 {
+		t.Errorf("subscriptions per transport mgr=%v", status.mgrSubscriptions)
+	}
+	if !status.connected[0] || !status.connected[1] {
+		t.Errorf("connection state not copied, connected=%v", status.connected)
+	}
+}
+
+func TestGetTreeVersion(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	if !initVssFile() {
+		t.Fatal("tree file not found")
+	}
+	version := getTreeVersion(getVssTreeRoot())
+	if len(version) > 0 && strings.Count(version, ".") != 2 {
+		t.Errorf("version=%s", version)
+	}
+}
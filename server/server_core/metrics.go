@@ -0,0 +1,65 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Server core metrics, exposed in addition to the request, notification, and token validation metrics of utils.
+* The gauges of the routing state are set by the server hub, which owns the state.
+**/
+
+var metricsPortNum int = 9081 // 0 disables the metrics endpoint, set from the configuration at startup
+
+var serviceRequestDuration = utils.NewHistogram("vissv2_service_request_duration_seconds", "Time from forwarding a request to the service managers until all have responded, by action.", utils.DefaultLatencyBuckets, "action")
+var tokenServerDuration = utils.NewHistogram("vissv2_token_server_duration_seconds", "Access token server response time.", utils.DefaultLatencyBuckets)
+var subscriptionGauge = utils.NewGauge("vissv2_subscriptions", "Active subscriptions.")
+var pendingRequestGauge = utils.NewGauge("vissv2_pending_requests", "Requests waiting for service manager responses.")
+
+func init() {
+	utils.NewGaugeFunc("vissv2_transport_mgrs", "Registered transport managers.", func() float64 {
+		transportMgrMutex.RLock()
+		defer transportMgrMutex.RUnlock()
+		return float64(len(transportMgrs))
+	})
+	utils.NewGaugeFunc("vissv2_draining", "1 while the server core is draining, see the admin API.", func() float64 {
+		if isDraining() {
+			return 1
+		}
+		return 0
+	})
+}
+
+/**
+* countBackendMessage counts a message sent to a transport mgr as a notification, or as a response by action and result.
+**/
+func countBackendMessage(message string) {
+	action, result := utils.MessageResult(message)
+	if action == "subscription" && result == "ok" {
+		utils.CountNotification()
+		return
+	}
+	utils.CountResponse(message)
+}
+
+func observeServiceRequest(pending *PendingRequest_t) {
+	serviceRequestDuration.Observe(time.Since(pending.created).Seconds(), pending.action)
+}
+
+/**
+* updateHubMetrics is called by the server hub after each event.
+**/
+func updateHubMetrics() {
+	subscriptionGauge.Set(float64(len(coreSubscriptionList)))
+	pendingRequestGauge.Set(float64(len(pendingRequests)))
+}
@@ -0,0 +1,78 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Request pipeline:
+* Requests from the transport mgrs are served by a pool of request workers, which concurrently validate the request,
+* search the VSS tree, and verify the access token. A slow access token server therefore only delays the requests that need it.
+* Error responses, and service discovery responses, are sent directly to the transport mgr by the worker.
+* Requests that shall be forwarded to service managers are handed back to the server hub,
+* which owns the routing state (service routing table, pending requests, and core subscriptions).
+* Requests from the same client may be served by different workers, so responses are not guaranteed to be in request order,
+* they are matched to the request by the requestId.
+**/
+
+type HubRequest_t struct {
+	requestMap map[string]interface{}
+	pathArray  []string // empty for unsubscribe requests
+	mgrId      int
+	auth       SubscriptionAuth_t // set for subscribe requests verified with an access token
+}
+
+var hubRequestChan = make(chan HubRequest_t, 100) // verified requests from the request workers to the server hub
+
+func requestWorker(requestChan chan TransportMessage_t) {
+	for transportMessage := range requestChan {
+		countTransportRequest(transportMessage.mgrId)
+		serveRequest(transportMessage.message, transportMessage.mgrId)
+	}
+}
+
+func startRequestWorkers(numOfWorkers int, requestChan chan TransportMessage_t) {
+	if numOfWorkers < 1 {
+		numOfWorkers = 1
+	}
+	for i := 0; i < numOfWorkers; i++ {
+		go requestWorker(requestChan)
+	}
+	utils.Info.Printf("startRequestWorkers():%d request workers started", numOfWorkers)
+}
+
+/**
+* routeHubRequest is called by the server hub for requests verified by a request worker.
+**/
+func routeHubRequest(hubRequest HubRequest_t) {
+	requestMap := hubRequest.requestMap
+	errorResponseMap := newErrorResponseMap()
+	if requestMap["action"] == "unsubscribe" {
+		if forwardUnsubscribeRequest(requestMap) == false {
+			utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrInvalidData, "Incorrect or missing subscription id.")
+			sendToBackend(hubRequest.mgrId, utils.FinalizeMessage(errorResponseMap))
+		}
+		return
+	}
+	parts, unownedPath := splitPathsPerService(hubRequest.pathArray)
+	if len(parts) == 0 {
+		utils.Error.Printf("routeHubRequest():no service manager for path=%s", unownedPath)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrServiceUnavailable, "No service manager serving "+unownedPath+".")
+		sendToBackend(hubRequest.mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	if requestMap["action"] == "set" && len(parts) > 1 { // the set is applied atomically by one service manager
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "The actuators of a set request must be served by one service manager.")
+		sendToBackend(hubRequest.mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	forwardServiceRequest(requestMap, parts, hubRequest.auth)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+const benchAtsDelay = 5 * time.Millisecond // access token server response time
+const benchClients = 64                    // concurrent clients, each having one outstanding request
+
+var benchOnce sync.Once
+var benchMgr *TransportMgr_t
+
+/**
+* useBenchTree sets a tree of its own, with access control on Vehicle.Speed, as the VSS tree during the benchmark,
+* so that the tree used by the tests is not modified.
+**/
+func useBenchTree(b *testing.B) {
+	treeRoot, err := treemgr.ReadTree(vssTreeFname, vssOverlayFnames)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, searchData := searchTree(treeRoot, "Vehicle.Speed", false, true, 0, nil, nil)
+	searchData[0].NodeHandle.Validate = 2 // read-write access control
+	vssTreeMutex.Lock()
+	savedTreeRoot := VSSTreeRoot
+	VSSTreeRoot = treeRoot
+	vssTreeMutex.Unlock()
+	b.Cleanup(func() {
+		vssTreeMutex.Lock()
+		VSSTreeRoot = savedTreeRoot
+		vssTreeMutex.Unlock()
+		treemgr.ReleaseTree(treeRoot)
+	})
+}
+
+/**
+* setupPipelineBenchmark starts a fake access token server, a fake service manager, a fake transport mgr, and the server hub.
+**/
+func setupPipelineBenchmark(b *testing.B) {
+	benchOnce.Do(func() {
+		utils.InitLog("servercore-log.txt", "./logs", false, "error")
+		ats := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(benchAtsDelay)
+			w.Write([]byte(`{"validation":"0"}`))
+		}))
+		_, port, _ := net.SplitHostPort(ats.Listener.Addr().String())
+		atsPortNum, _ = strconv.Atoi(port)
+		utils.Config.Hosts.AtServer = "127.0.0.1"
+
+		registerService("Vehicle", "127.0.0.1")
+		serviceRouting = append(serviceRouting, ServiceRoute_t{"Vehicle", 0})
+		serviceConnected[0] = true
+		serviceResponses := make(chan string, benchClients) // decouples the fake service mgr, as the WS session does
+		go func() {
+			for request := range getServiceDataChan(0) {
+				var requestMap = make(map[string]interface{})
+				utils.MapRequest(request, &requestMap)
+				serviceResponses <- `{"action":"get", "requestId":"` + requestMap["requestId"].(string) + `", "value":"1", "ts":"` + utils.GetRfcTime() + `"}`
+			}
+		}()
+		go func() {
+			for response := range serviceResponses {
+				serviceResponseChan <- ServiceMessage_t{0, response}
+			}
+		}()
+
+		benchMgr = &TransportMgr_t{mgrId: 1, mgrIndex: 0, backendChan: make(chan string, benchClients), done: make(chan struct{})}
+		transportMgrs[1] = benchMgr
+		go serverHub(make(chan string))
+	})
+}
+
+func TestSetRequestValidation(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	if !initVssFile() {
+		t.Fatal("tree file not found")
+	}
+	requestMap := map[string]interface{}{"action": "set", "path": "Vehicle.Cabin.Seat.Row1.Pos1", "value": []interface{}{"10", "20"},
+		"filter": map[string]interface{}{"type": "paths", "value": []interface{}{"Position", "Recline"}}}
+	if _, err := validRequest(requestMap); err != nil {
+		t.Errorf("multi-actuator set rejected: %s", err)
+	}
+	requestMap["value"] = []interface{}{"10"}
+	if _, err := validRequest(requestMap); err == nil {
+		t.Error("set accepted with fewer values than paths")
+	}
+	requestMap["filter"] = map[string]interface{}{"type": "timebased", "value": map[string]interface{}{"period": "3"}}
+	if _, err := validRequest(requestMap); err == nil {
+		t.Error("set accepted with a timebased filter")
+	}
+
+	var pathArray []string
+	for _, test := range []struct {
+		path   string
+		reason string // empty if the path is a valid target
+	}{
+		{"Vehicle.Cabin.Seat.Row1.Pos1.Position", ""},
+		{"Vehicle.Cabin.Seat.Row1.Pos1.Position", "bad_request"}, // already addressed
+		{"Vehicle.Cabin.Seat.Row1.Pos1.IsBelted", "forbidden_request"},
+		{"Vehicle.Cabin.Seat.Row1.Pos1.Switch.*", "bad_request"},
+		{"Vehicle.Cabin.Seat.Row1.Pos1.NoSuchSignal", "unavailable_data"},
+	} {
+		matches, searchData := searchTree(getVssTreeRoot(), test.path, true, true, 0, nil, nil)
+		errorCode, _ := validSetTarget(test.path, matches, searchData, pathArray)
+		if errorCode.Reason != test.reason {
+			t.Errorf("%s: expected reason %q, got %q", test.path, test.reason, errorCode.Reason)
+		}
+		if matches == 1 {
+			pathArray = append(pathArray, searchData[0].NodePath)
+		}
+	}
+}
+
+func makeBenchToken() string {
+	now := time.Now().Unix()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iat":` + strconv.FormatInt(now-10, 10) + `,"exp":` + strconv.FormatInt(now+3600, 10) + `}`))
+	return header + "." + payload + ".signature"
+}
+
+func runPipelineBenchmark(b *testing.B, numOfWorkers int, request string) {
+	setupPipelineBenchmark(b)
+	requestChan := make(chan TransportMessage_t)
+	startRequestWorkers(numOfWorkers, requestChan)
+	defer close(requestChan)
+
+	var mutex sync.Mutex
+	waiting := map[string]chan struct{}{}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			var response string
+			select {
+			case response = <-benchMgr.backendChan:
+			case <-stop:
+				return
+			}
+			var responseMap = make(map[string]interface{})
+			utils.MapRequest(response, &responseMap)
+			if responseMap["error"] != nil {
+				b.Errorf("error response: %s", response)
+			}
+			mutex.Lock()
+			done := waiting[responseMap["requestId"].(string)]
+			mutex.Unlock()
+			if done != nil {
+				done <- struct{}{}
+			}
+		}
+	}()
+
+	latencies := make([]time.Duration, b.N)
+	var next int64 = -1
+	var nextMutex sync.Mutex
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	start := time.Now()
+	for c := 0; c < benchClients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := make(chan struct{}, 1)
+			for {
+				nextMutex.Lock()
+				next++
+				i := next
+				nextMutex.Unlock()
+				if i >= int64(b.N) {
+					return
+				}
+				requestId := strconv.FormatInt(i, 10)
+				mutex.Lock()
+				waiting[requestId] = done
+				mutex.Unlock()
+				sent := time.Now()
+				requestChan <- TransportMessage_t{1, `{"RouterId":"1?0", "action":"get", "path":"Vehicle.Speed", "requestId":"` + requestId + `"` + request + `}`}
+				<-done
+				latencies[i] = time.Since(sent)
+				mutex.Lock()
+				delete(waiting, requestId)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "req/s")
+	b.ReportMetric(float64(latencies[b.N/2].Microseconds())/1000, "ms-p50")
+	b.ReportMetric(float64(latencies[b.N*99/100].Microseconds())/1000, "ms-p99")
+}
+
+func BenchmarkRequestPipeline(b *testing.B) {
+	useBenchTree(b)
+	authorization := `, "authorization":"` + makeBenchToken() + `"`
+	for _, numOfWorkers := range []int{1, 8, 64} {
+		b.Run("token/workers="+strconv.Itoa(numOfWorkers), func(b *testing.B) {
+			runPipelineBenchmark(b, numOfWorkers, authorization)
+		})
+	}
+}
@@ -12,7 +12,6 @@ package main
 
 import (
 	//   "fmt"
-	"flag"
 	"fmt"
 	"os"
 	"regexp"
@@ -22,77 +21,46 @@ import (
 
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
-	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
 	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
 )
 
-var VSSTreeRoot *gomodel.Node_t
+var VSSTreeRoot *treemgr.Node_t
+var vssTreeMutex sync.RWMutex // VSSTreeRoot is swapped when the tree is reloaded, while the request workers search it
 
-// set to MAXFOUNDNODES in cparserlib.h
-const MAXFOUNDNODES = 1500
-
-var transportRegChan chan int
+// the port numbers are set from the configuration at startup, see utils/config.go
 var transportRegPortNum int = 8081
-var transportDataPortNum int = 8100 // port number interval [8100-]
-
-// add element to both channels if support for new transport protocol is added
-var transportDataChan = []chan string{
-	make(chan string),
-	make(chan string),
-	make(chan string),
-}
-
-var backendChan = []chan string{
-	make(chan string),
-	make(chan string),
-	make(chan string),
-}
-
-/*
-* To add support for one more transport manager protocol:
-*    - add a map entry to supportedProtocols
-*    - add a komponent to the muxServer array
-*    - add a component to the transportDataChan array
-*    - add a select case in the main loop
- */
-var supportedProtocols = map[int]string{
-	0: "HTTP",
-	1: "WebSocket",
-	2: "MQTT",
-}
+var transportDataPortNum int = 8100 // port number interval [8100-], see transportregistry.go
 
 var serviceRegChan chan string
 var serviceRegPortNum int = 8082
 var serviceDataPortNum int = 8200 // port number interval [8200-]
 
-// add element if support for new service manager is added
-var serviceDataChan = []chan string{
-	make(chan string),
-	make(chan string),
-}
+var atsPortNum int = 8600 // access token server
+
+var serviceReconnectMinBackoff = 1 * time.Second
+var serviceReconnectMaxBackoff = 30 * time.Second
 
 /** muxServer[0] is assigned to transport registration server,
 *   muxServer[1] is assigned to service registration server,
-*   of the following the first half is assigned for transport data servers,
-*   and the second half is assigned for service data clients
+*   the following are assigned for service data clients.
+*   Transport data servers are allocated at transport mgr registration.
 **/
 var muxServer = []*http.ServeMux{
 	http.NewServeMux(), // 0 = transport reg
 	http.NewServeMux(), // 1 = service reg
-	http.NewServeMux(), // 2 = transport data
-	http.NewServeMux(), // 3 = transport data
-	http.NewServeMux(), // 4 = service data
-	http.NewServeMux(), // 5 = service data
+	http.NewServeMux(), // 2 = service data
+	http.NewServeMux(), // 3 = service data
 }
 
 var upgrader = websocket.Upgrader{
@@ -100,19 +68,15 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-type RouterTable_t struct {
-	mgrId    int
-	mgrIndex int
-}
-
-var routerTable []RouterTable_t
-
-var errorResponseMap = map[string]interface{}{
-	"RouterId":  0,
-	"action":    "unknown",
-	"requestId": "XXX",
-	"error":     `{"number":AAA, "reason": "BBB", "message": "CCC"}`,
-	"ts":        1234,
+// requests are served concurrently, so each error response is built in its own map
+func newErrorResponseMap() map[string]interface{} {
+	return map[string]interface{}{
+		"RouterId":  0,
+		"action":    "unknown",
+		"requestId": "XXX",
+		"error":     `{"number":AAA, "reason": "BBB", "message": "CCC"}`,
+		"ts":        1234,
+	}
 }
 
 /*
@@ -127,29 +91,12 @@ var errorResponseMap = map[string]interface{}{
     - service discovery response synthesis
 */
 
-func routerTableAdd(mgrId int, mgrIndex int) {
-	var tableElement RouterTable_t
-	tableElement.mgrId = mgrId
-	tableElement.mgrIndex = mgrIndex
-	routerTable = append(routerTable, tableElement)
-}
-
 func extractMgrId(routerId string) int { // "RouterId" : "mgrId?clientId"
 	delim := strings.Index(routerId, "?")
 	mgrId, _ := strconv.Atoi(routerId[:delim])
 	return mgrId
 }
 
-func routerTableSearchForMgrIndex(routerId string) int {
-	mgrId := extractMgrId(routerId)
-	for _, element := range routerTable {
-		if element.mgrId == mgrId {
-			return element.mgrIndex
-		}
-	}
-	return -1
-}
-
 func getRouterId(response string) string { // "RouterId" : "mgrId?clientId",
 	afterRouterIdKey := strings.Index(response, "RouterId")
 	if afterRouterIdKey == -1 {
@@ -165,15 +112,11 @@ func getRouterId(response string) string { // "RouterId" : "mgrId?clientId",
 /*
 * The transportRegisterServer assigns a requesting transport mgr the data channel port number to use,
 * the data channel URL path, and the transport mgr ID that shall be added to the server internal req/resp messages.
-* This is communicated to the coreserver that will save it in its router database.
-* The port number returned is unique per protocol supported.
-* If there is a need to support registering of multiple mgrs for the same protocol,
-* then caching assigned mgr data can be used to assign other unique portno + mgr ID. Currently not supported.
+* Any protocol is accepted, and multiple mgrs may register for the same protocol, see transportregistry.go.
  */
-func maketransportRegisterHandler(transportRegChannel chan int) func(http.ResponseWriter, *http.Request) {
+func maketransportRegisterHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		utils.Info.Printf("transportRegisterServer():url=%s", req.URL.Path)
-		mgrIndex := -1
 		if req.URL.Path != "/transport/reg" {
 			http.Error(w, "404 url path not found.", 404)
 		} else if req.Method != "POST" {
@@ -185,37 +128,35 @@ func maketransportRegisterHandler(transportRegChannel chan int) func(http.Respon
 			decoder := json.NewDecoder(req.Body)
 			var payload Payload
 			err := decoder.Decode(&payload)
-			if err != nil {
-				panic(err)
+			if err != nil || len(payload.Protocol) == 0 {
+				http.Error(w, "400 protocol missing.", 400)
+				return
 			}
 			utils.Info.Printf("transportRegisterServer():POST request=%s", payload.Protocol)
-			for key, value := range supportedProtocols {
-				if payload.Protocol == value {
-					mgrIndex = key
-				}
+			if isDraining() {
+				http.Error(w, "503 server is draining.", 503)
+				return
 			}
-			if mgrIndex != -1 { // communicate: port no + mgr Id to server hub, port no + url path + mgr Id to transport mgr
-				transportRegChannel <- transportDataPortNum + mgrIndex // port no
-				mgrId := rand.Intn(65535)                              // [0 -65535], 16-bit value
-				transportRegChannel <- mgrId                           // mgr id
-				w.Header().Set("Content-Type", "application/json")
-				response := "{ \"Portnum\" : " + strconv.Itoa(transportDataPortNum+mgrIndex) + " , \"Urlpath\" : \"/transport/data/" + strconv.Itoa(mgrIndex) + "\"" + " , \"Mgrid\" : " + strconv.Itoa(mgrId) + " }"
-
-				utils.Info.Printf("transportRegisterServer():POST response=%s", response)
-				w.Write([]byte(response)) // correct JSON?
-				routerTableAdd(mgrId, mgrIndex)
-			} else {
-				http.Error(w, "404 protocol not supported.", 404)
+			mgr, err := registerTransportMgr(payload.Protocol)
+			if err != nil {
+				utils.Error.Printf("transportRegisterServer():registration failed, err=%s", err)
+				http.Error(w, "503 data channel could not be allocated.", 503)
+				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			response := "{ \"Portnum\" : " + strconv.Itoa(mgr.portNum) + " , \"Urlpath\" : \"" + getTransportDataUrlPath(mgr.mgrIndex) + "\"" + " , \"Mgrid\" : " + strconv.Itoa(mgr.mgrId) + " }"
+
+			utils.Info.Printf("transportRegisterServer():POST response=%s", response)
+			w.Write([]byte(response)) // correct JSON?
 		}
 	}
 }
 
-func initTransportRegisterServer(transportRegChannel chan int) {
-	utils.Info.Printf("initTransportRegisterServer(): :8081/transport/reg")
-	transportRegisterHandler := maketransportRegisterHandler(transportRegChannel)
+func initTransportRegisterServer() {
+	utils.Info.Printf("initTransportRegisterServer(): :%d/transport/reg", transportRegPortNum)
+	transportRegisterHandler := maketransportRegisterHandler()
 	muxServer[0].HandleFunc("/transport/reg", transportRegisterHandler)
-	utils.Error.Fatal(http.ListenAndServe(":8081", muxServer[0]))
+	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(transportRegPortNum), muxServer[0]))
 }
 
 func frontendServiceDataComm(dataConn *websocket.Conn, request string) {
@@ -225,52 +166,99 @@ func frontendServiceDataComm(dataConn *websocket.Conn, request string) {
 	}
 }
 
-func backendServiceDataComm(dataConn *websocket.Conn, backendChannel []chan string, serviceIndex int) {
+func backendServiceDataComm(dataConn *websocket.Conn, serviceResponseChannel chan ServiceMessage_t, serviceIndex int, closed chan struct{}) {
+	defer close(closed)
 	for {
 		_, response, err := dataConn.ReadMessage()
 		utils.Info.Printf("Server core: Response from service mgr:%s", string(response))
 		if err != nil {
 			utils.Error.Println("Service datachannel read error:", err)
-			response = []byte(utils.FinalizeMessage(errorResponseMap)) // needs improvement
+			serviceConnectionChan <- ServiceConnection_t{serviceIndex, false} // the server hub fails the requests outstanding at the service manager
+			return
 		}
-		mgrIndex := routerTableSearchForMgrIndex(getRouterId(string(response)))
-		utils.Info.Printf("mgrIndex=%d", mgrIndex)
-		backendChannel[mgrIndex] <- string(response)
+		serviceResponseChannel <- ServiceMessage_t{serviceIndex, string(response)} // responses are routed by the server hub
 	}
 }
 
 /**
 * initServiceDataSession:
-* sets up the WS based communication (as client) with a service manager
+* sets up the WS based communication (as client) with a service manager, returns nil if the service manager is not reachable
 **/
-func initServiceDataSession(muxServer *http.ServeMux, serviceIndex int, backendChannel []chan string, remoteIp string) (dataConn *websocket.Conn) {
-	var addr = flag.String("addr", remoteIp+":"+strconv.Itoa(serviceDataPortNum+serviceIndex), "http service address")
-	dataSessionUrl := url.URL{Scheme: "ws", Host: *addr, Path: "/service/data/" + strconv.Itoa(serviceIndex)}
+func initServiceDataSession(serviceIndex int, remoteIp string) *websocket.Conn {
+	dataSessionUrl := url.URL{Scheme: "ws", Host: remoteIp + ":" + strconv.Itoa(serviceDataPortNum+serviceIndex), Path: "/service/data/" + strconv.Itoa(serviceIndex)}
 	utils.Info.Printf("Connecting to:%s", dataSessionUrl.String())
-	dataConn, _, err := websocket.DefaultDialer.Dial(dataSessionUrl.String(), http.Header{"Access-Control-Allow-Origin": {"*"}})
-	//    dataConn, _, err := websocket.DefaultDialer.Dial(dataSessionUrl.String(), nil)
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	dataConn, _, err := dialer.Dial(dataSessionUrl.String(), http.Header{"Access-Control-Allow-Origin": {"*"}})
 	if err != nil {
-		utils.Error.Fatal("Service data session dial error:", err)
+		utils.Error.Print("Service data session dial error:", err)
 		return nil
 	}
-	go backendServiceDataComm(dataConn, backendChannel, serviceIndex)
 	return dataConn
 }
 
-func initServiceClientSession(serviceDataChannel chan string, serviceIndex int, backendChannel []chan string, remoteIp string) {
-	time.Sleep(3 * time.Second)                               //wait for service data server to be initiated (initiate at first app-client request instead...)
-	muxIndex := (len(muxServer)-2)/2 + 1 + (serviceIndex + 1) //could be more intuitive...
-	utils.Info.Printf("initServiceClientSession: muxIndex=%d", muxIndex)
-	dataConn := initServiceDataSession(muxServer[muxIndex], serviceIndex, backendChannel, remoteIp)
+/**
+* dropServiceRequests discards the requests to a service manager that is not connected, until done is closed.
+* The server hub does not forward requests to it, so these are only requests forwarded before the hub was informed.
+**/
+func dropServiceRequests(serviceDataChannel chan string, done chan struct{}) {
 	for {
 		select {
 		case request := <-serviceDataChannel:
-			frontendServiceDataComm(dataConn, request)
+			utils.Warning.Printf("dropServiceRequests():service mgr not connected, request dropped=%s", request)
+		case <-done:
+			return
+		}
+	}
+}
+
+/**
+* connectServiceDataSession retries to connect to the service manager with exponential backoff.
+**/
+func connectServiceDataSession(serviceDataChannel chan string, serviceIndex int) *websocket.Conn {
+	backoff := serviceReconnectMinBackoff
+	for {
+		var dataConn *websocket.Conn
+		done := make(chan struct{})
+		go func() {
+			dataConn = initServiceDataSession(serviceIndex, getServiceRemoteIp(serviceIndex))
+			close(done)
+		}()
+		dropServiceRequests(serviceDataChannel, done)
+		if dataConn != nil {
+			return dataConn
+		}
+		utils.Info.Printf("connectServiceDataSession():service index=%d, retry in %s", serviceIndex, backoff)
+		done = make(chan struct{})
+		time.AfterFunc(backoff, func() { close(done) })
+		dropServiceRequests(serviceDataChannel, done)
+		backoff *= 2
+		if backoff > serviceReconnectMaxBackoff {
+			backoff = serviceReconnectMaxBackoff
 		}
 	}
 }
 
-func makeServiceRegisterHandler(serviceRegChannel chan string, serviceIndex *int, backendChannel []chan string) func(http.ResponseWriter, *http.Request) {
+func initServiceClientSession(serviceDataChannel chan string, serviceIndex int, serviceResponseChannel chan ServiceMessage_t) {
+	time.Sleep(3 * time.Second) //wait for service data server to be initiated (initiate at first app-client request instead...)
+	for {
+		dataConn := connectServiceDataSession(serviceDataChannel, serviceIndex)
+		serviceConnectionChan <- ServiceConnection_t{serviceIndex, true} // the server hub replays the subscriptions served by the service manager
+		closed := make(chan struct{})
+		go backendServiceDataComm(dataConn, serviceResponseChannel, serviceIndex, closed)
+		for isConnected := true; isConnected; {
+			select {
+			case request := <-serviceDataChannel:
+				frontendServiceDataComm(dataConn, request)
+			case <-closed:
+				isConnected = false
+			}
+		}
+		dataConn.Close()
+		utils.Info.Printf("initServiceClientSession():service index=%d disconnected, reconnecting...", serviceIndex)
+	}
+}
+
+func makeServiceRegisterHandler(serviceRegChannel chan string, serviceIndex *int, serviceResponseChannel chan ServiceMessage_t) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		var re = regexp.MustCompile(`^[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}`)
 		remoteIp := re.FindString(req.RemoteAddr)
@@ -290,128 +278,54 @@ func makeServiceRegisterHandler(serviceRegChannel chan string, serviceIndex *int
 				panic(err)
 			}
 			utils.Info.Printf("serviceRegisterServer(index=%d):received POST request=%s", *serviceIndex, payload.Rootnode)
-			if *serviceIndex < 2 { // communicate: port no + root node to server hub, port no + url path to transport mgr, and start a client session
-				serviceRegChannel <- strconv.Itoa(serviceDataPortNum + *serviceIndex)
-				serviceRegChannel <- payload.Rootnode
-				*serviceIndex += 1
-				w.Header().Set("Content-Type", "application/json")
-				response := "{ \"Portnum\" : " + strconv.Itoa(serviceDataPortNum+*serviceIndex-1) + " , \"Urlpath\" : \"/service/data/" + strconv.Itoa(*serviceIndex-1) + "\"" + " }"
-
+			if len(payload.Rootnode) == 0 {
+				payload.Rootnode = "Vehicle"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			index, isReregistration := registerService(payload.Rootnode, remoteIp)
+			if index >= 0 { // communicate: port no + root node to server hub, port no + url path to transport mgr, and start a client session
+				response := "{ \"Portnum\" : " + strconv.Itoa(serviceDataPortNum+index) + " , \"Urlpath\" : \"/service/data/" + strconv.Itoa(index) + "\"" + " }"
 				utils.Info.Printf("serviceRegisterServer():POST response=%s", response)
 				w.Write([]byte(response))
-				go initServiceClientSession(serviceDataChan[*serviceIndex-1], *serviceIndex-1, backendChannel, remoteIp)
+				if isReregistration { // restarted service mgr, the client session reconnects to it
+					utils.Info.Printf("serviceRegisterServer():Root node %s registered again.", payload.Rootnode)
+					return
+				}
+				serviceRegChannel <- strconv.Itoa(serviceDataPortNum + index)
+				serviceRegChannel <- payload.Rootnode
+				*serviceIndex = index + 1
+				go initServiceClientSession(getServiceDataChan(index), index, serviceResponseChannel)
 			} else {
 				utils.Info.Printf("serviceRegisterServer():Max number of services already registered.")
+				w.Write([]byte("{ \"Portnum\" : -1 , \"Urlpath\" : \"\" }"))
 			}
 		}
 	}
 }
 
-func initServiceRegisterServer(serviceRegChannel chan string, serviceIndex *int, backendChannel []chan string) {
-	utils.Info.Printf("initServiceRegisterServer(): :8082/service/reg")
-	serviceRegisterHandler := makeServiceRegisterHandler(serviceRegChannel, serviceIndex, backendChannel)
+func initServiceRegisterServer(serviceRegChannel chan string, serviceIndex *int, serviceResponseChannel chan ServiceMessage_t) {
+	utils.Info.Printf("initServiceRegisterServer(): :%d/service/reg", serviceRegPortNum)
+	serviceRegisterHandler := makeServiceRegisterHandler(serviceRegChannel, serviceIndex, serviceResponseChannel)
 	muxServer[1].HandleFunc("/service/reg", serviceRegisterHandler)
-	utils.Error.Fatal(http.ListenAndServe(":8082", muxServer[1]))
-}
-
-func frontendWSDataSession(conn *websocket.Conn, transportDataChannel chan string, backendChannel chan string) {
-	defer conn.Close()
-	for {
-		_, msg, err := conn.ReadMessage()
-		if err != nil {
-			utils.Error.Print("read error data WS protocol.", err)
-			break
-		}
-
-		utils.Info.Printf("%s request: %s", conn.RemoteAddr(), string(msg))
-		transportDataChannel <- string(msg) // send request to server hub
-	}
-}
-
-func backendWSDataSession(conn *websocket.Conn, backendChannel chan string) {
-	defer conn.Close()
-	for {
-		message := <-backendChannel
-
-		utils.Info.Printf("%s Transport mgr server: message= %s", conn.RemoteAddr(), message)
-		err := conn.WriteMessage(websocket.TextMessage, []byte(message))
-		if err != nil {
-			utils.Error.Print("write error data WS protocol.", err)
-			break
-		}
-	}
-}
-
-func makeTransportDataHandler(transportDataChannel chan string, backendChannel chan string) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, req *http.Request) {
-		if req.Header.Get("Upgrade") == "websocket" {
-			utils.Info.Printf("we are upgrading to a websocket connection.")
-			upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-			conn, err := upgrader.Upgrade(w, req, nil)
-			if err != nil {
-				utils.Error.Print("upgrade:", err)
-				return
-			}
-			utils.Info.Printf("WS data session initiated.")
-			go frontendWSDataSession(conn, transportDataChannel, backendChannel)
-			go backendWSDataSession(conn, backendChannel)
-		} else {
-			http.Error(w, "400 protocol must be websocket.", 400)
-		}
-	}
-}
-
-/**
-*  All transport data servers implement a WS server which communicates with a transport protocol manager.
-**/
-func initTransportDataServer(mgrIndex int, muxServer *http.ServeMux, transportDataChannel []chan string, backendChannel []chan string) {
-	utils.Info.Printf("initTransportDataServer():mgrIndex=%d", mgrIndex)
-	transportDataHandler := makeTransportDataHandler(transportDataChannel[mgrIndex], backendChannel[mgrIndex])
-	muxServer.HandleFunc("/transport/data/"+strconv.Itoa(mgrIndex), transportDataHandler)
-	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(transportDataPortNum+mgrIndex), muxServer))
-}
-
-func initTransportDataServers(transportDataChannel []chan string, backendChannel []chan string) {
-	for key, _ := range supportedProtocols {
-		go initTransportDataServer(key, muxServer[key+2], transportDataChannel, backendChannel) //muxelements 0 and one assigned to reg servers
-	}
-}
-
-func updateServiceRouting(portNo string, rootNode string) {
-	utils.Info.Printf("updateServiceRouting(): portnum=%s, rootNode=%s", portNo, rootNode)
+	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(serviceRegPortNum), muxServer[1]))
 }
 
 func initVssFile() bool {
-	filePath := "vss_vissv2.binary"
-	VSSTreeRoot = golib.VSSReadTree(filePath)
+	var err error
+	VSSTreeRoot, err = treemgr.ReadTree(vssTreeFname, vssOverlayFnames)
 
 	if VSSTreeRoot == nil {
-		//		utils.Error.Println("Tree file not found")
+		utils.Error.Printf("initVssFile():%s", err)
 		return false
 	}
+	vssTreeLoadTime = time.Now()
 
 	return true
 }
 
-func searchTree(rootNode *gomodel.Node_t, path string, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string, validation *int) (int, []golib.SearchData_t) {
+func searchTree(rootNode *treemgr.Node_t, path string, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string, validation *int) (int, []treemgr.SearchData_t) {
 	utils.Info.Printf("searchTree(): path=%s, anyDepth=%t, leafNodesOnly=%t", path, anyDepth, leafNodesOnly)
-	if len(path) > 0 {
-		var searchData []golib.SearchData_t
-		var matches int
-		searchData, matches = golib.VSSsearchNodes(path, rootNode, MAXFOUNDNODES, anyDepth, leafNodesOnly, listSize, noScopeList, validation)
-		//		searchData, matches = golib.VSSsearchNodes(path, rootNode, MAXFOUNDNODES, anyDepth, leafNodesOnly, validation)
-		return matches, searchData
-	}
-	return 0, nil
-}
-
-func getPathLen(path string) int {
-	for i := 0; i < len(path); i++ {
-		if path[i] == 0x00 { // the path buffer defined in searchData_t is initiated with all zeros
-			return i
-		}
-	}
-	return len(path)
+	return treemgr.SearchNodes(rootNode, path, anyDepth, leafNodesOnly, listSize, noScopeList, validation)
 }
 
 func getTokenErrorMessage(index int) string {
@@ -436,21 +350,34 @@ func getTokenErrorMessage(index int) string {
 	return "Unknown error. "
 }
 
-func setTokenErrorResponse(reqMap map[string]interface{}, errorCode int) {
+/**
+* setTokenErrorResponse selects the error from the token error bits, where the scope and access mode bits take precedence over the token validity bits.
+**/
+func setTokenErrorResponse(reqMap map[string]interface{}, errorResponseMap map[string]interface{}, errorCode int) {
+	errorBits := -errorCode // the error code is the negated sum of the error bits
 	errMsg := ""
 	bitValid := 1
 	for i := 0; i < 8; i++ {
-		if errorCode&bitValid == bitValid {
+		if errorBits&bitValid == bitValid {
 			errMsg += getTokenErrorMessage(i)
 		}
 		bitValid = bitValid << 1
 	}
-	utils.SetErrorResponse(reqMap, errorResponseMap, "400", "Bad Request", errMsg)
+	tokenError := utils.ErrInvalidToken
+	switch {
+	case errorBits&(4|8) != 0: // purpose scope, access mode
+		tokenError = utils.ErrForbiddenRequest
+	case errorBits&32 != 0:
+		tokenError = utils.ErrExpiredToken
+	case errorBits == 1:
+		tokenError = utils.ErrMissingToken
+	}
+	utils.SetErrorResponse(reqMap, errorResponseMap, tokenError, strings.TrimSpace(errMsg))
 }
 
 func accessTokenServerValidation(token string, paths string, action string, validation int) int {
-	hostIp := utils.GetServerIP()
-	url := "http://" + hostIp + ":8600/atserver"
+	hostIp := utils.Config.Hosts.AtServer
+	url := "http://" + hostIp + ":" + strconv.Itoa(atsPortNum) + "/atserver"
 	utils.Info.Printf("accessTokenServerValidation::url = %s", url)
 
 	data := []byte(`{"token":"` + token + `","paths":` + paths + `,"action":"` + action + `","validation":"` + strconv.Itoa(validation) + `"}`)
@@ -464,13 +391,15 @@ func accessTokenServerValidation(token string, paths string, action string, vali
 	// Set headers
 	req.Header.Set("Access-Control-Allow-Origin", "*")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Host", hostIp+":8600")
+	req.Header.Set("Host", hostIp+":"+strconv.Itoa(atsPortNum))
 
 	// Set client timeout
 	client := &http.Client{Timeout: time.Second * 10}
 
 	// Send request
+	start := time.Now()
 	resp, err := client.Do(req)
+	tokenServerDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
 		utils.Error.Print("accessTokenServerValidation: Error reading response. ", err)
 		return -128
@@ -559,106 +488,14 @@ func addQuery(path string) string {
 	return ""
 }
 
-// nativeCnodeDef.h: nodeTypes_t;
-func nodeTypesToString(nodeType int) string {
-	switch nodeType {
-	case 1:
-		return "sensor"
-	case 2:
-		return "actuator"
-	case 3:
-		return "attribute"
-	case 4:
-		return "branch"
-	default:
-		return ""
-	}
-}
-
-// nativeCnodeDef.h: nodeDatatypes_t
-func nodeDataTypesToString(nodeType int) string {
-	switch nodeType {
-	case 1:
-		return "int8"
-	case 2:
-		return "uint8"
-	case 3:
-		return "int16"
-	case 4:
-		return "uint16"
-	case 5:
-		return "int32"
-	case 6:
-		return "uint32"
-	case 7:
-		return "double"
-	case 8:
-		return "float"
-	case 9:
-		return "boolean"
-	case 10:
-		return "string"
-	default:
-		return ""
-	}
-}
-
-func jsonifyTreeNode(nodeHandle *gomodel.Node_t, jsonBuffer string, depth int, maxDepth int) string {
-	if depth >= maxDepth {
-		return jsonBuffer
-	}
-	depth++
-	var newJsonBuffer string
-	nodeName := golib.VSSgetName(nodeHandle)
-	newJsonBuffer += `"` + nodeName + `":{`
-	nodeType := int(golib.VSSgetType(nodeHandle))
-	utils.Info.Printf("nodeType=%d", nodeType)
-	newJsonBuffer += `"type":` + `"` + nodeTypesToString(nodeType) + `",`
-	nodeDescr := golib.VSSgetDescr(nodeHandle)
-	newJsonBuffer += `"description":` + `"` + nodeDescr + `",`
-	nodeNumofChildren := golib.VSSgetNumOfChildren(nodeHandle)
-	switch nodeType {
-	case 4: // branch
-	case 1: // sensor
-		fallthrough
-	case 2: // actuator
-		fallthrough
-	case 3: // attribute
-		// TODO Look for other metadata, unit, enum, ...
-		nodeDatatype := golib.VSSgetDatatype(nodeHandle)
-		newJsonBuffer += `"datatype:"` + `"` + nodeDataTypesToString(int(nodeDatatype)) + `",`
-	default:
-		return ""
-
-	}
-	if depth < maxDepth {
-		if nodeNumofChildren > 0 {
-			newJsonBuffer += `"children":` + "{"
-		}
-		for i := 0; i < nodeNumofChildren; i++ {
-			childNode := golib.VSSgetChild(nodeHandle, i)
-			newJsonBuffer += jsonifyTreeNode(childNode, jsonBuffer, depth, maxDepth)
-		}
-		if nodeNumofChildren > 0 {
-			newJsonBuffer = newJsonBuffer[:len(newJsonBuffer)-1] // remove comma after curly bracket
-			newJsonBuffer += "}"
-		}
-	}
-	if newJsonBuffer[len(newJsonBuffer)-1] == ',' && newJsonBuffer[len(newJsonBuffer)-2] != '}' {
-		newJsonBuffer = newJsonBuffer[:len(newJsonBuffer)-1]
-	}
-	newJsonBuffer += "},"
-	return jsonBuffer + newJsonBuffer
-}
-
 func countPathSegments(path string) int {
 	return strings.Count(path, ".") + 1
 }
 
 func getNoScopeList(tokenContext string) ([]string, int) {
 	// call ATS to get list
-	hostIp := utils.GetServerIP()
-	url := "http://" + hostIp + ":8600/atserver"
+	hostIp := utils.Config.Hosts.AtServer
+	url := "http://" + hostIp + ":" + strconv.Itoa(atsPortNum) + "/atserver"
 
 	data := []byte(`{"context":"` + tokenContext + `"}`)
 
@@ -671,7 +508,7 @@ func getNoScopeList(tokenContext string) ([]string, int) {
 	// Set headers
 	req.Header.Set("Access-Control-Allow-Origin", "*")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Host", hostIp+":8600")
+	req.Header.Set("Host", hostIp+":"+strconv.Itoa(atsPortNum))
 
 	// Set client timeout
 	client := &http.Client{Timeout: time.Second * 10}
@@ -732,22 +569,26 @@ func extractNoScopeElementsLevel2(noScopeMap []interface{}) ([]string, int) {
 	return noScopeList, i
 }
 
+/**
+* synthesizeJsonTree returns the metadata of the node at path, and of the nodes at most depth levels below it. A negative depth means no limit.
+**/
 func synthesizeJsonTree(path string, depth int, tokenContext string) string {
 	var jsonBuffer string
-	var searchData []golib.SearchData_t
+	var searchData []treemgr.SearchData_t
 	var matches int
 	noScopeList, numOfListElem := getNoScopeList(tokenContext)
 	//utils.Info.Printf("noScopeList[0]=%s", noScopeList[0])
-	matches, searchData = searchTree(VSSTreeRoot, path, false, false, numOfListElem, noScopeList, nil)
+	matches, searchData = searchTree(getVssTreeRoot(), path, false, false, numOfListElem, noScopeList, nil)
 	if matches < countPathSegments(path) {
 		return ""
 	}
 	subTreeRoot := searchData[matches-1].NodeHandle
-	utils.Info.Printf("synthesizeJsonTree:subTreeRoot-name=%s", golib.VSSgetName(subTreeRoot))
-	if depth == 0 {
-		depth = 100
+	utils.Info.Printf("synthesizeJsonTree:subTreeRoot-name=%s", subTreeRoot.Name)
+	maxDepth := depth + 1
+	if depth < 0 {
+		maxDepth = 100
 	}
-	jsonBuffer = jsonifyTreeNode(subTreeRoot, jsonBuffer, 0, depth)
+	jsonBuffer = treemgr.JsonifyTreeNode(subTreeRoot, jsonBuffer, 0, maxDepth)
 	if len(jsonBuffer) > 0 {
 		return "{" + jsonBuffer[:len(jsonBuffer)-1] + "}" // remove comma
 	}
@@ -761,203 +602,207 @@ func getTokenContext(reqMap map[string]interface{}) string {
 	return ""
 }
 
-func validRequest(request string, action string) bool {
-	switch (action) {
-	  case "get": return isValidGetParams(request)
-	  case "set": return isValidSetParams(request)
-	  case "subscribe": return isValidSubscribeParams(request)
-	  case "unsubscribe": return isValidUnsubscribeParams(request)
-	}
-	return false
-}
-
-func isValidGetParams(request string) bool {
-	if (strings.Contains(request, "path") == false) {
-	    return false
-	}
-	if (strings.Contains(request, "filter") == true) {
-	    return isValidGetFilter(request)  
+/**
+* addDynamicMetadataFilter replaces the "metadata":"dynamic" request member with a dynamic-metadata filter expression,
+* which is what the service managers act on.
+**/
+func addDynamicMetadataFilter(requestMap map[string]interface{}, filterList []utils.FilterObject) []utils.FilterObject {
+	delete(requestMap, "metadata")
+	if utils.GetFilter(filterList, utils.FILTER_DYNAMIC_METADATA) != nil {
+		return filterList
+	}
+	expression := map[string]interface{}{"type": utils.FILTER_DYNAMIC_METADATA, "value": ""}
+	switch filter := requestMap["filter"].(type) {
+	case []interface{}:
+		requestMap["filter"] = append(filter, expression)
+	case map[string]interface{}:
+		requestMap["filter"] = []interface{}{filter, expression}
+	default:
+		requestMap["filter"] = expression
 	}
-	return true
+	return append(filterList, utils.FilterObject{Type: utils.FILTER_DYNAMIC_METADATA, DynamicMetadata: &utils.DynamicMetadataFilter{}})
 }
 
-func isValidGetFilter(request string) bool { // paths, history,static-metadata, dynamic-metadata supported
-	if (strings.Contains(request, "paths") == true) {
-	    if (strings.Contains(request, "value") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "history") == true) {
-	    if (strings.Contains(request, "value") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "static-metadata") == true) {
-	    if (strings.Contains(request, "value") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "dynamic-metadata") == true) {
-	    if (strings.Contains(request, "value") == true) {
-			return true
+/**
+* validRequest checks the action specific request members, and returns the parsed filter if present.
+**/
+func validRequest(requestMap map[string]interface{}) ([]utils.FilterObject, error) {
+	action, _ := requestMap["action"].(string)
+	switch action {
+	case "get":
+		fallthrough
+	case "subscribe":
+		if action == "subscribe" && requestMap["subscriptionId"] != nil { // token refresh of a live subscription
+			if requestMap["path"] != nil {
+				return nil, errors.New("path not allowed in a token refresh")
+			}
+			if _, ok := requestMap["authorization"].(string); !ok {
+				return nil, errors.New("authorization missing")
+			}
+			return nil, nil
 		}
+		if _, ok := requestMap["path"].(string); !ok {
+			return nil, errors.New("path missing")
+		}
+		if requestMap["filter"] == nil {
+			return nil, nil
+		}
+		filterList, err := utils.UnpackFilter(requestMap["filter"])
+		if err != nil {
+			return nil, err
+		}
+		if err = utils.ValidateFilterList(action, filterList); err != nil || action != "subscribe" {
+			return filterList, err
+		}
+		return filterList, utils.ValidateFilterCombination(filterList)
+	case "set":
+		if _, ok := requestMap["path"].(string); !ok {
+			return nil, errors.New("path missing")
+		}
+		if requestMap["value"] == nil {
+			return nil, errors.New("value missing")
+		}
+		if requestMap["filter"] == nil {
+			return nil, nil
+		}
+		filterList, err := utils.UnpackFilter(requestMap["filter"])
+		if err != nil {
+			return nil, err
+		}
+		if err = utils.ValidateFilterList(action, filterList); err != nil {
+			return nil, err
+		}
+		return filterList, validSetValues(requestMap["value"], len(utils.GetFilter(filterList, utils.FILTER_PATHS).Paths))
+	case "unsubscribe":
+		if requestMap["subscriptionId"] == nil {
+			return nil, errors.New("subscriptionId missing")
+		}
+		return nil, nil
 	}
-	return false
-}
-
-func isValidSetParams(request string) bool {
-	return strings.Contains(request, "path") && strings.Contains(request, "value")
-}
-
-func isValidSubscribeParams(request string) bool {
-	if (strings.Contains(request, "path") == false) {
-	    return false
-	}
-	if (strings.Contains(request, "filter") == true) {
-	    return isValidSubscribeFilter(request)  
-	}
-	return true
+	return nil, errors.New("unknown action")
 }
 
-func isValidSubscribeFilter(request string) bool { // paths, history, timebased, range, change, curvelog, static-metadata, dynamic-metadata supported
-	if (isValidGetFilter(request) == true) {
-	    return true
-	}
-	if (strings.Contains(request, "timebased") == true) {
-	    if (strings.Contains(request, "value") == true  && strings.Contains(request, "period") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "range") == true) {
-	    if (strings.Contains(request, "value") == true  && strings.Contains(request, "logic-op") == true && 
-	        strings.Contains(request, "boundary") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "change") == true) {
-	    if (strings.Contains(request, "value") == true  && strings.Contains(request, "logic-op") == true && 
-	        strings.Contains(request, "diff") == true) {
-	        return true
-	    }
-	}
-	if (strings.Contains(request, "curvelog") == true) {
-	    if (strings.Contains(request, "value") == true  && strings.Contains(request, "maxerr") == true && 
-	        strings.Contains(request, "bufsize") == true) {
-			return true
+/**
+* validSetValues checks that a set request having a paths filter has an array with one value per path.
+**/
+func validSetValues(value interface{}, numOfPaths int) error {
+	valueArray, ok := value.([]interface{})
+	if !ok || len(valueArray) != numOfPaths {
+		return errors.New("value must be an array with one value per path of the paths filter")
+	}
+	for _, element := range valueArray {
+		if _, ok := element.(string); !ok {
+			return errors.New("values must be strings")
 		}
 	}
-	return false
+	return nil
 }
 
-func isValidUnsubscribeParams(request string) bool {
-	return strings.Contains(request, "subscriptionId")
-}
-
-func serveRequest(request string, tDChanIndex int, sDChanIndex int) {
+func serveRequest(request string, mgrId int) {
+	errorResponseMap := newErrorResponseMap()
 	var requestMap = make(map[string]interface{})
 	if utils.MapRequest(request, &requestMap) != 0 {
 		utils.Error.Printf("serveRequest():invalid JSON format=%s", request)
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "invalid request syntax", "See VISSv2 spec and JSON RFC for valid request syntax.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "See VISSv2 spec and JSON RFC for valid request syntax.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	if isDraining() && requestMap["action"] != "unsubscribe" && requestMap["subscriptionId"] == nil { // clients may still terminate their subscriptions, or refresh their tokens
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrServiceUnavailable, "The server is draining.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
-	if requestMap["action"] == nil || validRequest(request, requestMap["action"].(string)) == false {
-		utils.Error.Printf("serveRequest():invalid action params=%s", requestMap["action"])
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "invalid request syntax", "Request parameter invalid.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+	filterList, err := validRequest(requestMap)
+	if err != nil {
+		utils.Error.Printf("serveRequest():invalid action params=%s, err=%s", requestMap["action"], err)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, err.Error())
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
 	if requestMap["path"] != nil && strings.Contains(requestMap["path"].(string), "*") == true {
 		utils.Error.Printf("serveRequest():path contained wildcard=%s", requestMap["path"])
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "invalid request syntax", "Wildcard must be in filter expression.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Wildcard must be in filter expression.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
 	if requestMap["path"] != nil {
 		requestMap["path"] = utils.UrlToPath(requestMap["path"].(string)) // replace slash with dot
 	}
-	if requestMap["action"] == "set" && requestMap["filter"] != nil {
-		utils.Error.Printf("serveRequest():Set request combined with filtering.")
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "invalid request", "Set request must not contain filtering.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+	if requestMap["action"] == "unsubscribe" {
+		hubRequestChan <- HubRequest_t{requestMap, nil, mgrId, SubscriptionAuth_t{}} // the subscription list is owned by the server hub
 		return
 	}
-	if requestMap["action"] == "unsubscribe" {
-		serviceDataChan[sDChanIndex] <- request
+	if requestMap["action"] == "subscribe" && requestMap["subscriptionId"] != nil {
+		refreshSubscriptionToken(requestMap, mgrId)
 		return
 	}
-	if requestMap["action"] == "get" && requestMap["path"] != nil && requestMap["metadata"] != nil == true {
+	if requestMap["action"] == "get" && requestMap["metadata"] == "dynamic" { // dynamic metadata is provided by the service managers
+		filterList = addDynamicMetadataFilter(requestMap, filterList)
+	}
+	staticMetadataFilter := utils.GetFilter(filterList, utils.FILTER_STATIC_METADATA)
+	if requestMap["action"] == "get" && requestMap["path"] != nil && (requestMap["metadata"] != nil || staticMetadataFilter != nil) {
 		tokenContext := getTokenContext(requestMap)
 		if len(tokenContext) == 0 {
 			tokenContext = "Undefined+Undefined+Undefined"
 		}
 		metadata := ""
-		if requestMap["metadata"] == "static" {
-			metadata = synthesizeJsonTree(requestMap["path"].(string), 0, tokenContext) // TODO: depth setting via filtering?
-		} else {
-			// TODO: get dynamic metadata
+		if staticMetadataFilter != nil {
+			metadata = synthesizeJsonTree(requestMap["path"].(string), staticMetadataFilter.StaticMetadata.Depth, tokenContext)
+		} else if requestMap["metadata"] == "static" {
+			metadata = synthesizeJsonTree(requestMap["path"].(string), -1, tokenContext)
 		}
 		if len(metadata) > 0 {
 			delete(requestMap, "path")
 			delete(requestMap, "metadata")
+			delete(requestMap, "filter")
 			requestMap["ts"] = utils.GetRfcTime()
-			backendChan[tDChanIndex] <- utils.AddKeyValue(utils.FinalizeMessage(requestMap), "metadata", metadata)
+			sendToBackend(mgrId, utils.AddKeyValue(utils.FinalizeMessage(requestMap), "metadata", metadata))
 			return
 		}
 		utils.Error.Printf("Metadata not available.")
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Bad request", "Metadata not available.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrUnavailableData, "Metadata not available.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
-	issueServiceRequest(requestMap, tDChanIndex, sDChanIndex)
+	issueServiceRequest(requestMap, filterList, mgrId)
 }
 
-func issueServiceRequest(requestMap map[string]interface{}, tDChanIndex int, sDChanIndex int) {
+func issueServiceRequest(requestMap map[string]interface{}, filterList []utils.FilterObject, mgrId int) {
+	errorResponseMap := newErrorResponseMap()
 	rootPath := requestMap["path"].(string)
 	var searchPath []string
-	if requestMap["filter"] != nil {
-		var filterList []utils.FilterObject
-		utils.UnpackFilter(requestMap["filter"], &filterList)
-		for i := 0; i < len(filterList); i++ {
-			utils.Info.Printf("filterList[%d].Type=%s, filterList[%d].Value=%s", i, filterList[i].Type, i, filterList[i].Value)
-			if filterList[i].Type == "paths" {
-				if strings.Contains(filterList[i].Value, "[") == true {
-					err := json.Unmarshal([]byte(filterList[i].Value), &searchPath)
-					if err != nil {
-						utils.Error.Printf("Unmarshal filter path array failed.")
-						utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Internal error.", "Unmarshall failed on array of paths.")
-						backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
-						return
-					}
-					for i := 0; i < len(searchPath); i++ {
-						searchPath[i] = rootPath + "." + utils.UrlToPath(searchPath[i]) // replace slash with dot
-					}
-				} else {
-					searchPath = make([]string, 1)
-					searchPath[0] = rootPath + "." + filterList[i].Value
-				}
-				break // only one paths object is allowed
-			}
+	pathsFilter := utils.GetFilter(filterList, utils.FILTER_PATHS)
+	if pathsFilter != nil {
+		searchPath = make([]string, len(pathsFilter.Paths))
+		for i := 0; i < len(pathsFilter.Paths); i++ {
+			searchPath[i] = rootPath + "." + utils.UrlToPath(pathsFilter.Paths[i]) // replace slash with dot
 		}
-	}
-	if requestMap["filter"] == nil || len(searchPath) == 0 {
+	} else {
 		searchPath = make([]string, 1)
 		searchPath[0] = rootPath
 	}
-	var searchData []golib.SearchData_t
+	var searchData []treemgr.SearchData_t
 	var matches int
 	totalMatches := 0
 	paths := ""
+	var pathArray []string
 	maxValidation := -1
 	for i := 0; i < len(searchPath); i++ {
 		anyDepth := true
 		validation := -1
-		matches, searchData = searchTree(VSSTreeRoot, searchPath[i], anyDepth, true, 0, nil, &validation)
+		matches, searchData = searchTree(getVssTreeRoot(), searchPath[i], anyDepth, true, 0, nil, &validation)
 		//utils.Info.Printf("Path=%s, Matches=%d. Max validation from search=%d", searchPath[i], matches, int(validation))
 		utils.Info.Printf("Matches=%d. Max validation from search=%d", matches, int(validation))
+		if requestMap["action"] == "set" {
+			if errorCode, message := validSetTarget(searchPath[i], matches, searchData, pathArray); len(message) > 0 {
+				utils.SetErrorResponse(requestMap, errorResponseMap, errorCode, message)
+				sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+				return
+			}
+		}
 		for i := 0; i < matches; i++ {
-			pathLen := getPathLen(string(searchData[i].NodePath[:]))
-			paths += "\"" + string(searchData[i].NodePath[:pathLen]) + "\", "
+			paths += "\"" + searchData[i].NodePath + "\", "
+			pathArray = append(pathArray, searchData[i].NodePath)
 		}
 		totalMatches += matches
 		if int(validation) > maxValidation {
@@ -965,19 +810,15 @@ func issueServiceRequest(requestMap map[string]interface{}, tDChanIndex int, sDC
 		}
 	}
 	if totalMatches == 0 {
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "No signals matching path.", "")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
-		return
-	}
-	if requestMap["action"] == "set" && golib.VSSgetType(searchData[0].NodeHandle) != gomodel.ACTUATOR {
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Illegal command", "Only the actuator node type can be set.")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrUnavailableData, "No signals matching path.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
 	paths = paths[:len(paths)-2]
 	if totalMatches > 1 {
 		paths = "[" + paths + "]"
 	}
+	var auth SubscriptionAuth_t // kept by the subscription, see subscriptiontoken.go
 	switch maxValidation {
 	case 0: // validation not required
 	case 1:
@@ -986,55 +827,56 @@ func issueServiceRequest(requestMap map[string]interface{}, tDChanIndex int, sDC
 		errorCode := 0
 		if requestMap["authorization"] == nil {
 			errorCode = -1
+			utils.CountTokenValidation(errorCode)
 		} else {
 			if requestMap["action"] != "get" || maxValidation != 1 { // no validation for read requests when validation is 1 (write-only)
 				errorCode = verifyToken(requestMap["authorization"].(string), requestMap["action"].(string), paths, maxValidation)
+				utils.CountTokenValidation(errorCode)
+				if requestMap["action"] == "subscribe" {
+					auth = SubscriptionAuth_t{getTokenExpiry(requestMap["authorization"].(string)), paths, maxValidation}
+				}
 			}
 		}
 		if errorCode < 0 {
-			setTokenErrorResponse(requestMap, errorCode)
-			backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+			setTokenErrorResponse(requestMap, errorResponseMap, errorCode)
+			sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 			return
 		}
 	default: // should not be possible...
-		utils.SetErrorResponse(requestMap, errorResponseMap, "400", "VSS access restriction tag invalid.", "See VSS2.0 spec for access restriction tagging")
-		backendChan[tDChanIndex] <- utils.FinalizeMessage(errorResponseMap)
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "VSS access restriction tag invalid, see VSS2.0 spec for access restriction tagging.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
 		return
 	}
-	requestMap["path"] = paths
-	serviceDataChan[sDChanIndex] <- utils.FinalizeMessage(requestMap)
-}
-
-func updateTransportRoutingTable(mgrId int, portNum int) {
-	utils.Info.Printf("Dummy updateTransportRoutingTable, mgrId=%d, portnum=%d", mgrId, portNum)
-}
-
-type PathList struct {
-	LeafPaths []string
+	hubRequestChan <- HubRequest_t{requestMap, pathArray, mgrId, auth} // the service routing is owned by the server hub
 }
 
-var pathList PathList
-
-func sortPathList(listFname string) {
-	data, err := ioutil.ReadFile(listFname)
-	if err != nil {
-		utils.Error.Printf("Error reading %s: %s\n", listFname, err)
-		return
+/**
+* validSetTarget checks that a path of a set request addresses exactly one actuator, that is not already addressed by the request.
+* The values of a set request are matched with the paths by position, so a path matching none or multiple signals is rejected.
+**/
+func validSetTarget(searchPath string, matches int, searchData []treemgr.SearchData_t, pathArray []string) (utils.ErrorCode_t, string) {
+	if matches == 0 {
+		return utils.ErrUnavailableData, "No signal matching " + searchPath + "."
 	}
-	err = json.Unmarshal([]byte(data), &pathList)
-	if err != nil {
-		utils.Error.Printf("Error unmarshal json=%s\n", err)
-		return
+	if matches > 1 {
+		return utils.ErrBadRequest, "Set request must address single actuators, " + searchPath + " matches " + strconv.Itoa(matches) + " signals."
+	}
+	if searchData[0].NodeHandle.NodeType != gomodel.ACTUATOR {
+		return utils.ErrForbiddenRequest, "Only the actuator node type can be set, " + searchData[0].NodePath + " is not an actuator."
+	}
+	for _, path := range pathArray {
+		if path == searchData[0].NodePath {
+			return utils.ErrBadRequest, "Set request addresses " + path + " more than once."
+		}
 	}
-	sort.Strings(pathList.LeafPaths)
-	file, _ := json.Marshal(pathList)
-	_ = ioutil.WriteFile(listFname, file, 0644)
+	return utils.ErrorCode_t{}, ""
 }
 
 func createPathListFile(listFname string) {
-	// call int VSSGetLeafNodesList(long rootNode, char* leafNodeList);
-	golib.VSSGetLeafNodesList(VSSTreeRoot, listFname)
-	sortPathList(listFname)
+	err := treemgr.WritePathList(getVssTreeRoot(), listFname)
+	if err != nil {
+		utils.Error.Printf("createPathListFile():could not write %s, err=%s", listFname, err)
+	}
 }
 
 func main() {
@@ -1047,6 +889,11 @@ func main() {
 		Help:     "changes log output level",
 		Default:  "info"})
 	pathList := parser.Flag("", "dryrun", &argparse.Options{Required: false, Help: "dry run to generate vsspathlist file", Default: false})
+	reqTimeout := parser.Int("", "reqtimeout", &argparse.Options{Required: false, Help: "service request timeout in seconds", Default: 10})
+	numOfWorkers := parser.Int("", "workers", &argparse.Options{Required: false, Help: "number of request worker goroutines", Default: 8})
+	treeFormat := parser.Selector("", "treeformat", []string{"binary", "json"}, &argparse.Options{Required: false, Help: "VSS tree file format, vss_vissv2.binary or vss_vissv2.json is read", Default: "binary"})
+	overlays := parser.List("", "overlay", &argparse.Options{Required: false, Help: "VSS overlay file applied to the tree, may be repeated"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 	// Parse input
 	err := parser.Parse(os.Args)
 	if err != nil {
@@ -1054,43 +901,71 @@ func main() {
 	}
 
 	utils.InitLog("servercore-log.txt", "./logs", *logFile, *logLevel)
-
+	utils.InitConfig(*configFile)
+	transportRegPortNum = utils.Config.Ports.TransportReg
+	transportDataPortNum = utils.Config.Ports.TransportData
+	serviceRegPortNum = utils.Config.Ports.ServiceReg
+	serviceDataPortNum = utils.Config.Ports.ServiceData
+	atsPortNum = utils.Config.Ports.AtServer
+	adminPortNum = utils.Config.Ports.Admin
+	metricsPortNum = utils.Config.MetricsPorts.ServerCore
+	vssPathListFname = utils.Config.Paths.VssPathList
+
+	if *treeFormat == "json" {
+		vssTreeFname = "vss_vissv2.json"
+	}
+	vssOverlayFnames = *overlays
 	if !initVssFile() {
 		utils.Error.Fatal(" Tree file not found")
 		return
 	}
-	createPathListFile("../vsspathlist.json") // save in server directory, where transport managers will expect it to be
+	createPathListFile(vssPathListFname) // save in server directory, where transport managers will expect it to be
 	if *pathList {
 		return
 	}
+	go watchVssTree()
 
-	initTransportDataServers(transportDataChan, backendChan)
-	utils.Info.Printf("main():initTransportDataServers() executed...")
-	transportRegChan := make(chan int, 2*2)
-	go initTransportRegisterServer(transportRegChan)
+	serviceRequestTimeout = time.Duration(*reqTimeout) * time.Second
+	go initAdminServer()
+	go utils.ServeMetrics(metricsPortNum)
+
+	go initTransportRegisterServer()
 	utils.Info.Printf("main():initTransportRegisterServer() executed...")
 	serviceRegChan := make(chan string, 2)
 	serviceIndex := 0 // index assigned to registered services
-	go initServiceRegisterServer(serviceRegChan, &serviceIndex, backendChan)
+	go initServiceRegisterServer(serviceRegChan, &serviceIndex, serviceResponseChan)
+	startRequestWorkers(*numOfWorkers, transportDataChan)
 	utils.Info.Printf("main():starting loop for channel receptions...")
+	serverHub(serviceRegChan)
+}
+
+/**
+* serverHub owns the routing state, and serializes all access to it.
+**/
+func serverHub(serviceRegChan chan string) {
+	timeoutTicker := time.NewTicker(100 * time.Millisecond)
+	defer timeoutTicker.Stop()
 	for {
 		select {
-		case portNum := <-transportRegChan: // save port no + transport mgr Id in routing table
-			mgrId := <-transportRegChan
-			updateTransportRoutingTable(mgrId, portNum)
-		case request := <-transportDataChan[0]: // request from transport0 (=HTTP), verify it, and route matches to servicemgr, or execute and respond if servicemgr not needed
-			serveRequest(request, 0, 0)
-		case request := <-transportDataChan[1]: // request from transport1 (=WS), verify it, and route matches to servicemgr, or execute and respond if servicemgr not needed
-			serveRequest(request, 1, 0)
-		case request := <-transportDataChan[2]: // request from transport2 (=MQTT), verify it, and route matches to servicemgr, or execute and respond if servicemgr not needed
-			serveRequest(request, 2, 0)
-			//        case xxx := <- transportDataChan[3]:  // implement when there is a 4th transport protocol mgr
+		case hubRequest := <-hubRequestChan: // request verified by a request worker, route it to the servicemgr(s)
+			routeHubRequest(hubRequest)
+		case mgrId := <-transportDeregChan: // transport mgr data session closed, terminate its subscriptions
+			removeTransportSubscriptions(mgrId)
 		case portNo := <-serviceRegChan: // save service data portnum and root node in routing table
 			rootNode := <-serviceRegChan
 			updateServiceRouting(portNo, rootNode)
-			//        case xxx := <- serviceDataChan[0]:    // for asynchronous routing, instead of the synchronous above. ToDo?
-		default:
-			time.Sleep(10 * time.Millisecond)
+		case serviceMessage := <-serviceResponseChan: // response or notification from a service manager, merge and route it to the transport mgr
+			processServiceResponse(serviceMessage.serviceIndex, serviceMessage.message)
+		case serviceConnection := <-serviceConnectionChan: // service mgr data channel connected or dropped, replay subscriptions or fail outstanding requests
+			updateServiceConnection(serviceConnection)
+		case now := <-timeoutTicker.C: // fail requests not responded to in time, and terminate subscriptions having an expired token
+			expirePendingRequests(now)
+			expireSubscriptionTokens(now)
+		case tokenRequest := <-subscriptionTokenChan: // token refresh of a subscription by a request worker
+			tokenRequest.replyChan <- updateSubscriptionToken(tokenRequest)
+		case statusChan := <-hubStatusChan: // routing state requested by the admin server
+			statusChan <- getHubStatus()
 		}
+		updateHubMetrics()
 	}
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSetTokenErrorResponse(t *testing.T) {
+	for _, test := range []struct {
+		errorCode int
+		reason    string
+		message   string
+	}{
+		{-8, "forbidden_request", "Insufficient access mode permission."}, // a set with a read-only token, see validateScopeAndAccessMode() in the AT server
+		{-4, "forbidden_request", "Invalid purpose scope."},
+		{-16, "invalid_token", "Invalid issued at time."},
+		{-32, "expired_token", "Token expired."},
+		{-1, "missing_token", "Token missing."},
+	} {
+		reqMap := map[string]interface{}{"action": "set", "requestId": "1"}
+		errorResponseMap := map[string]interface{}{}
+		setTokenErrorResponse(reqMap, errorResponseMap, test.errorCode)
+		errorObject := errorResponseMap["error"].(map[string]interface{})
+		if errorObject["reason"] != test.reason || errorObject["message"] != test.message {
+			t.Errorf("error code %d: unexpected error %v", test.errorCode, errorObject)
+		}
+	}
+}
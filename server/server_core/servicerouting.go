@@ -0,0 +1,685 @@
+/**
+* (C) 2020 Mitsubishi Electrics Automotive
+* (C) 2019 Geotab Inc
+* (C) 2019 Volvo Cars
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Service routing:
+* Each service manager registers with the root node of the VSS subtree it serves, e.g. "Vehicle", or "Vehicle.Private.OEM".
+* A path is owned by the service manager having the longest registered root node that is a prefix of the path.
+* A request addressing paths owned by multiple service managers is split into one request per manager,
+* and the responses are merged into one response to the client.
+* Service managers assign subscription ids independently, so the core server assigns its own subscription ids
+* to clients, and translates them to/from the ids of the service managers.
+* A request that is not responded to by all its service managers within serviceRequestTimeout, or that is outstanding
+* at a service manager whose data channel drops, is completed with an error response to the client.
+* The core server reconnects to a service manager whose data channel dropped, and a restarted service manager may register again
+* with the same root node, which gives it the same service index. When reconnected, the service manager subscriptions of the dropped
+* data session are unsubscribed, as the service manager may have kept running, and the subscriptions served by the service manager
+* are replayed. The new service manager subscription ids are mapped to the core subscription ids the clients already have.
+* All functions in this file are called from the server hub, so no locking is needed.
+**/
+
+type ServiceRoute_t struct {
+	rootNode     string
+	serviceIndex int
+}
+
+var serviceRouting []ServiceRoute_t
+
+type RegisteredService_t struct {
+	rootNode string
+	remoteIp string
+	dataChan chan string // requests to the service manager, allocated at registration
+}
+
+// registered service managers, the slice index is the service index. Accessed by the service registration server, the service data sessions, and the server hub.
+var registeredServices []RegisteredService_t
+var registeredServicesMutex sync.Mutex
+
+const SERVICE_DATA_CHAN_SIZE = 1000 // room for the subscriptions replayed at reconnection, a request is failed when the channel is full
+
+// connection state of the service data sessions, key is the service index
+var serviceConnected = map[int]bool{}
+
+type ServiceMessage_t struct {
+	serviceIndex int
+	message      string
+}
+
+var serviceResponseChan = make(chan ServiceMessage_t)
+
+type ServiceConnection_t struct {
+	serviceIndex int
+	isConnected  bool
+}
+
+var serviceConnectionChan = make(chan ServiceConnection_t, 10) // connection state changes of the service data sessions
+
+// service manager subscription ids of dropped data sessions, unsubscribed at reconnection. Key is the service index
+var staleServiceSubscriptions = map[int][]string{}
+
+type ServiceRequestPart_t struct {
+	serviceIndex int
+	paths        []string
+}
+
+type ServiceSubscription_t struct {
+	serviceIndex   int
+	subscriptionId string                 // as assigned by the service manager, empty while the service manager is not connected
+	request        map[string]interface{} // the subscribe request sent to the service manager, replayed after reconnection
+}
+
+type CoreSubscription_t struct {
+	subscriptionId int // as assigned by the core server
+	routerId       string
+	serviceSubs    []ServiceSubscription_t
+	auth           SubscriptionAuth_t // token expiry of access restricted subscriptions, see subscriptiontoken.go
+}
+
+var coreSubscriptionList []CoreSubscription_t
+var coreSubscriptionId int = 1 // do not start with zero!
+
+type PendingRequest_t struct {
+	routerId       string
+	requestId      interface{} // as received from the client, nil if missing
+	action         string
+	subscriptionId int                            // core subscription id of a subscribe/unsubscribe request
+	serviceIndexes []int                          // service managers the request was sent to
+	outstanding    int                            // number of service managers yet to respond
+	partRequests   map[int]map[string]interface{} // subscribe requests per service index
+	responses      []ServiceResponse_t
+	isInternal     bool               // response is not forwarded to a client
+	isReplay       bool               // subscribe request replayed after reconnection
+	auth           SubscriptionAuth_t // of a subscribe request, kept by the created subscription
+	created        time.Time
+	deadline       time.Time
+}
+
+type ServiceResponse_t struct {
+	serviceIndex int
+	responseMap  map[string]interface{}
+}
+
+// the requestId of a request to a service manager is replaced by a key to the pending request
+var pendingRequests = map[string]*PendingRequest_t{}
+var internalRequestId int = 0
+
+var serviceRequestTimeout = 10 * time.Second
+
+const serviceBusyMessage = "Service manager request queue full."
+
+func updateServiceRouting(portNo string, rootNode string) {
+	utils.Info.Printf("updateServiceRouting(): portnum=%s, rootNode=%s", portNo, rootNode)
+	portNum, err := strconv.Atoi(portNo)
+	if err != nil {
+		utils.Error.Printf("updateServiceRouting(): invalid portnum=%s", portNo)
+		return
+	}
+	var route ServiceRoute_t
+	route.rootNode = rootNode
+	route.serviceIndex = portNum - serviceDataPortNum
+	serviceRouting = append(serviceRouting, route)
+}
+
+/**
+* registerService returns the service index for the root node, and whether it was registered before.
+* The service index is -1 if the max number of service managers, one per port of the service data port range, is already registered.
+**/
+func registerService(rootNode string, remoteIp string) (int, bool) {
+	registeredServicesMutex.Lock()
+	defer registeredServicesMutex.Unlock()
+	for i := 0; i < len(registeredServices); i++ {
+		if registeredServices[i].rootNode == rootNode {
+			registeredServices[i].remoteIp = remoteIp // a restarted service manager may have moved
+			return i, true
+		}
+	}
+	if len(registeredServices) == utils.ServiceDataPortRange {
+		return -1, false
+	}
+	registeredServices = append(registeredServices, RegisteredService_t{rootNode, remoteIp, make(chan string, SERVICE_DATA_CHAN_SIZE)})
+	return len(registeredServices) - 1, false
+}
+
+func getServiceDataChan(serviceIndex int) chan string {
+	registeredServicesMutex.Lock()
+	defer registeredServicesMutex.Unlock()
+	return registeredServices[serviceIndex].dataChan
+}
+
+/**
+* sendToService queues a request to the service manager without blocking the server hub on a slow or stuck service data session.
+* Returns false if the request is dropped as the channel is full.
+**/
+func sendToService(serviceIndex int, request string) bool {
+	select {
+	case getServiceDataChan(serviceIndex) <- request:
+		return true
+	default:
+		utils.Warning.Printf("sendToService():service index=%d, data channel full, request dropped=%s", serviceIndex, request)
+		return false
+	}
+}
+
+func getServiceRemoteIp(serviceIndex int) string {
+	registeredServicesMutex.Lock()
+	defer registeredServicesMutex.Unlock()
+	return registeredServices[serviceIndex].remoteIp
+}
+
+func isSubtreeOf(path string, rootNode string) bool {
+	return path == rootNode || strings.HasPrefix(path, rootNode+".")
+}
+
+func getServiceIndex(path string) int {
+	serviceIndex := -1
+	matchLen := 0
+	for _, route := range serviceRouting {
+		if isSubtreeOf(path, route.rootNode) && len(route.rootNode) > matchLen {
+			serviceIndex = route.serviceIndex
+			matchLen = len(route.rootNode)
+		}
+	}
+	return serviceIndex
+}
+
+/**
+* splitPathsPerService returns the paths grouped per owning service manager, in the order the managers first occur in the path list.
+* The path of the first unowned path is returned if there is one.
+**/
+func splitPathsPerService(paths []string) ([]ServiceRequestPart_t, string) {
+	var parts []ServiceRequestPart_t
+	for _, path := range paths {
+		serviceIndex := getServiceIndex(path)
+		if serviceIndex == -1 || !serviceConnected[serviceIndex] {
+			return nil, path
+		}
+		partIndex := -1
+		for i := 0; i < len(parts); i++ {
+			if parts[i].serviceIndex == serviceIndex {
+				partIndex = i
+				break
+			}
+		}
+		if partIndex == -1 {
+			parts = append(parts, ServiceRequestPart_t{serviceIndex: serviceIndex})
+			partIndex = len(parts) - 1
+		}
+		parts[partIndex].paths = append(parts[partIndex].paths, path)
+	}
+	return parts, ""
+}
+
+func packPaths(paths []string) string { // same format as expected by unpackPaths() in the service manager
+	packed := "\"" + strings.Join(paths, "\", \"") + "\""
+	if len(paths) > 1 {
+		packed = "[" + packed + "]"
+	}
+	return packed
+}
+
+func addPendingRequest(requestMap map[string]interface{}, serviceIndexes []int, subscriptionId int, isInternal bool) string {
+	pending := &PendingRequest_t{}
+	if routerId, ok := requestMap["RouterId"].(string); ok {
+		pending.routerId = routerId
+	}
+	pending.requestId = requestMap["requestId"]
+	pending.action, _ = requestMap["action"].(string)
+	pending.subscriptionId = subscriptionId
+	pending.serviceIndexes = serviceIndexes
+	pending.outstanding = len(serviceIndexes)
+	pending.isInternal = isInternal
+	pending.created = time.Now()
+	pending.deadline = pending.created.Add(serviceRequestTimeout)
+	internalRequestId++
+	key := strconv.Itoa(internalRequestId)
+	pendingRequests[key] = pending
+	return key
+}
+
+/**
+* forwardServiceRequest sends one request per part to the owning service manager. If the parts are more than one,
+* the responses are merged before being returned to the client.
+**/
+func forwardServiceRequest(requestMap map[string]interface{}, parts []ServiceRequestPart_t, auth SubscriptionAuth_t) {
+	var serviceIndexes []int
+	for _, part := range parts {
+		serviceIndexes = append(serviceIndexes, part.serviceIndex)
+	}
+	key := addPendingRequest(requestMap, serviceIndexes, 0, false)
+	pending := pendingRequests[key]
+	pending.auth = auth
+	pending.partRequests = make(map[int]map[string]interface{})
+	for _, part := range parts {
+		partMap := copyRequestMap(requestMap)
+		partMap["path"] = packPaths(part.paths)
+		partMap["requestId"] = key
+		pending.partRequests[part.serviceIndex] = partMap
+		if !sendToService(part.serviceIndex, utils.FinalizeMessage(partMap)) {
+			failPendingRequest(key, pending, utils.ErrServiceUnavailable, serviceBusyMessage)
+			return
+		}
+	}
+}
+
+func copyRequestMap(requestMap map[string]interface{}) map[string]interface{} {
+	copyMap := make(map[string]interface{})
+	for k, v := range requestMap {
+		copyMap[k] = v
+	}
+	return copyMap
+}
+
+func getCoreSubscriptionIndex(subscriptionId int) int {
+	for i := 0; i < len(coreSubscriptionList); i++ {
+		if coreSubscriptionList[i].subscriptionId == subscriptionId {
+			return i
+		}
+	}
+	return -1
+}
+
+func getCoreSubscriptionIndexByService(serviceIndex int, serviceSubscriptionId string) int {
+	for i := 0; i < len(coreSubscriptionList); i++ {
+		for _, serviceSub := range coreSubscriptionList[i].serviceSubs {
+			if serviceSub.serviceIndex == serviceIndex && serviceSub.subscriptionId == serviceSubscriptionId {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func removeCoreSubscription(index int) {
+	coreSubscriptionList = append(coreSubscriptionList[:index], coreSubscriptionList[index+1:]...)
+}
+
+/**
+* terminateCoreSubscription sends an error notification to the client, unsubscribes at the service managers, and removes the subscription.
+**/
+func terminateCoreSubscription(index int, errorObject map[string]interface{}) {
+	subscription := coreSubscriptionList[index]
+	notificationMap := map[string]interface{}{"RouterId": subscription.routerId, "action": "subscription", "subscriptionId": strconv.Itoa(subscription.subscriptionId)}
+	notificationMap["error"] = errorObject
+	notificationMap["ts"] = utils.GetRfcTime()
+	sendToTransport(subscription.routerId, utils.FinalizeMessage(notificationMap))
+	for _, serviceSub := range subscription.serviceSubs {
+		sendInternalUnsubscribe(subscription.routerId, serviceSub)
+	}
+	removeCoreSubscription(index)
+}
+
+/**
+* forwardUnsubscribeRequest translates the client subscription id to the ids of the service managers serving the subscription.
+* Returns false if the subscription id is not known.
+**/
+func forwardUnsubscribeRequest(requestMap map[string]interface{}) bool {
+	subscriptId, ok := requestMap["subscriptionId"].(string)
+	if !ok {
+		return false
+	}
+	subscriptionId, err := strconv.Atoi(subscriptId)
+	if err != nil {
+		return false
+	}
+	index := getCoreSubscriptionIndex(subscriptionId)
+	if index == -1 {
+		return false
+	}
+	serviceSubs := coreSubscriptionList[index].serviceSubs
+	var serviceIndexes []int
+	for _, serviceSub := range serviceSubs {
+		serviceIndexes = append(serviceIndexes, serviceSub.serviceIndex)
+	}
+	key := addPendingRequest(requestMap, serviceIndexes, subscriptionId, false)
+	pending := pendingRequests[key]
+	for _, serviceSub := range serviceSubs {
+		if !serviceConnected[serviceSub.serviceIndex] || len(serviceSub.subscriptionId) == 0 { // not active at the service manager
+			responseMap := map[string]interface{}{"action": "unsubscribe", "requestId": key, "ts": utils.GetRfcTime()}
+			pending.responses = append(pending.responses, ServiceResponse_t{serviceSub.serviceIndex, responseMap})
+			pending.outstanding--
+			continue
+		}
+		partMap := copyRequestMap(requestMap)
+		partMap["subscriptionId"] = serviceSub.subscriptionId
+		partMap["requestId"] = key
+		if !sendToService(serviceSub.serviceIndex, utils.FinalizeMessage(partMap)) {
+			failPendingRequest(key, pending, utils.ErrServiceUnavailable, serviceBusyMessage)
+			return true
+		}
+	}
+	if pending.outstanding == 0 {
+		completePendingRequest(key, pending)
+	}
+	return true
+}
+
+func sendInternalUnsubscribe(routerId string, serviceSub ServiceSubscription_t) {
+	if !serviceConnected[serviceSub.serviceIndex] || len(serviceSub.subscriptionId) == 0 {
+		return
+	}
+	requestMap := map[string]interface{}{"RouterId": routerId, "action": "unsubscribe"}
+	requestMap["requestId"] = addPendingRequest(requestMap, []int{serviceSub.serviceIndex}, 0, true)
+	requestMap["subscriptionId"] = serviceSub.subscriptionId
+	if !sendToService(serviceSub.serviceIndex, utils.FinalizeMessage(requestMap)) {
+		delete(pendingRequests, requestMap["requestId"].(string))
+	}
+}
+
+/**
+* processServiceResponse is called by the server hub for every message received from a service manager.
+**/
+func processServiceResponse(serviceIndex int, response string) {
+	var responseMap = make(map[string]interface{})
+	if utils.MapRequest(response, &responseMap) != 0 {
+		utils.Error.Printf("processServiceResponse():invalid JSON format=%s", response)
+		return
+	}
+	if responseMap["action"] == "subscription" {
+		forwardNotification(serviceIndex, responseMap)
+		return
+	}
+	key, _ := responseMap["requestId"].(string)
+	pending := pendingRequests[key]
+	if pending == nil {
+		utils.Warning.Printf("processServiceResponse():no pending request for response=%s", response)
+		if subscriptionId, ok := responseMap["subscriptionId"].(string); ok && responseMap["action"] == "subscribe" && responseMap["error"] == nil {
+			sendInternalUnsubscribe("", ServiceSubscription_t{serviceIndex: serviceIndex, subscriptionId: subscriptionId}) // the client already got an error response
+		}
+		return
+	}
+	pending.responses = append(pending.responses, ServiceResponse_t{serviceIndex, responseMap})
+	pending.outstanding--
+	if pending.outstanding > 0 {
+		return
+	}
+	completePendingRequest(key, pending)
+}
+
+func completePendingRequest(key string, pending *PendingRequest_t) {
+	delete(pendingRequests, key)
+	if pending.isReplay {
+		completeSubscriptionReplay(pending)
+		return
+	}
+	if pending.isInternal {
+		return
+	}
+	observeServiceRequest(pending)
+	responseMap := mergeServiceResponses(pending)
+	if pending.requestId != nil {
+		responseMap["requestId"] = pending.requestId
+	} else {
+		delete(responseMap, "requestId")
+	}
+	sendToTransport(pending.routerId, utils.FinalizeMessage(responseMap))
+}
+
+func hasResponded(pending *PendingRequest_t, serviceIndex int) bool {
+	for _, response := range pending.responses {
+		if response.serviceIndex == serviceIndex {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* failPendingRequest adds an error response for each service manager that has not responded, and completes the request.
+* Subscriptions activated by the service managers that did respond are then terminated by mergeSubscribeResponses().
+**/
+func failPendingRequest(key string, pending *PendingRequest_t, errorCode utils.ErrorCode_t, message string) {
+	for _, serviceIndex := range pending.serviceIndexes {
+		if hasResponded(pending, serviceIndex) {
+			continue
+		}
+		requestMap := map[string]interface{}{"RouterId": pending.routerId, "action": pending.action, "requestId": key}
+		errorResponseMap := newErrorResponseMap()
+		utils.SetErrorResponse(requestMap, errorResponseMap, errorCode, message)
+		pending.responses = append(pending.responses, ServiceResponse_t{serviceIndex, errorResponseMap})
+	}
+	pending.outstanding = 0
+	completePendingRequest(key, pending)
+}
+
+/**
+* expirePendingRequests is called periodically by the server hub, and fails the requests that have passed their deadline.
+**/
+func expirePendingRequests(now time.Time) {
+	for key, pending := range pendingRequests {
+		if now.After(pending.deadline) {
+			utils.Warning.Printf("expirePendingRequests():request timeout, RouterId=%s, requestId=%v", pending.routerId, pending.requestId)
+			failPendingRequest(key, pending, utils.ErrGatewayTimeout, "Service manager did not respond within "+serviceRequestTimeout.String()+".")
+		}
+	}
+}
+
+/**
+* failServiceRequests fails the requests outstanding at a service manager whose data channel dropped.
+**/
+func failServiceRequests(serviceIndex int) {
+	for key, pending := range pendingRequests {
+		for _, index := range pending.serviceIndexes {
+			if index == serviceIndex && !hasResponded(pending, serviceIndex) {
+				failPendingRequest(key, pending, utils.ErrServiceUnavailable, "Service manager connection lost.")
+				break
+			}
+		}
+	}
+}
+
+/**
+* updateServiceConnection is called by the server hub when a service data session is connected or dropped.
+**/
+func updateServiceConnection(connection ServiceConnection_t) {
+	serviceConnected[connection.serviceIndex] = connection.isConnected
+	if connection.isConnected {
+		replaySubscriptions(connection.serviceIndex)
+		return
+	}
+	for i := 0; i < len(coreSubscriptionList); i++ { // the subscriptions are lost at the service manager, or left to be unsubscribed at reconnection
+		for j := 0; j < len(coreSubscriptionList[i].serviceSubs); j++ {
+			serviceSub := &coreSubscriptionList[i].serviceSubs[j]
+			if serviceSub.serviceIndex == connection.serviceIndex && len(serviceSub.subscriptionId) > 0 {
+				staleServiceSubscriptions[connection.serviceIndex] = append(staleServiceSubscriptions[connection.serviceIndex], serviceSub.subscriptionId)
+				serviceSub.subscriptionId = ""
+			}
+		}
+	}
+	failServiceRequests(connection.serviceIndex)
+}
+
+/**
+* replaySubscriptions unsubscribes the subscriptions of the dropped data session, and resends the subscribe requests
+* of the active subscriptions served by a reconnected service manager.
+* A restarted service manager responds to the unsubscribe requests with an error, which is ignored.
+**/
+func replaySubscriptions(serviceIndex int) {
+	for _, serviceSubscriptionId := range staleServiceSubscriptions[serviceIndex] {
+		sendInternalUnsubscribe("", ServiceSubscription_t{serviceIndex: serviceIndex, subscriptionId: serviceSubscriptionId})
+	}
+	delete(staleServiceSubscriptions, serviceIndex)
+	var failedKeys []string // failed after the loop, as failing a replay terminates the subscription
+	for _, coreSubscription := range coreSubscriptionList {
+		for _, serviceSub := range coreSubscription.serviceSubs {
+			if serviceSub.serviceIndex != serviceIndex || len(serviceSub.subscriptionId) > 0 {
+				continue
+			}
+			requestMap := copyRequestMap(serviceSub.request)
+			key := addPendingRequest(requestMap, []int{serviceIndex}, coreSubscription.subscriptionId, true)
+			pendingRequests[key].isReplay = true
+			requestMap["requestId"] = key
+			utils.Info.Printf("replaySubscriptions():subscriptionId=%d, service index=%d", coreSubscription.subscriptionId, serviceIndex)
+			if !sendToService(serviceIndex, utils.FinalizeMessage(requestMap)) {
+				failedKeys = append(failedKeys, key)
+			}
+		}
+	}
+	for _, key := range failedKeys {
+		failPendingRequest(key, pendingRequests[key], utils.ErrServiceUnavailable, serviceBusyMessage)
+	}
+}
+
+func completeSubscriptionReplay(pending *PendingRequest_t) {
+	response := pending.responses[0]
+	serviceSubscriptionId, ok := response.responseMap["subscriptionId"].(string)
+	index := getCoreSubscriptionIndex(pending.subscriptionId)
+	if !ok || response.responseMap["error"] != nil {
+		utils.Error.Printf("completeSubscriptionReplay():replay of subscriptionId=%d failed", pending.subscriptionId)
+		if index != -1 { // the client would otherwise silently stop getting notifications
+			errorObject, isErrorObject := response.responseMap["error"].(map[string]interface{})
+			if !isErrorObject {
+				errorObject = utils.ErrorObject(utils.ErrServiceUnavailable, "")
+			}
+			errorObject["message"] = "The subscription could not be restored after a service manager reconnection, the subscription is terminated."
+			terminateCoreSubscription(index, errorObject)
+		}
+		return
+	}
+	if index == -1 { // unsubscribed during the replay
+		sendInternalUnsubscribe("", ServiceSubscription_t{serviceIndex: response.serviceIndex, subscriptionId: serviceSubscriptionId})
+		return
+	}
+	for i := 0; i < len(coreSubscriptionList[index].serviceSubs); i++ {
+		if coreSubscriptionList[index].serviceSubs[i].serviceIndex == response.serviceIndex {
+			coreSubscriptionList[index].serviceSubs[i].subscriptionId = serviceSubscriptionId
+		}
+	}
+}
+
+func forwardNotification(serviceIndex int, notificationMap map[string]interface{}) {
+	serviceSubscriptionId, _ := notificationMap["subscriptionId"].(string)
+	index := getCoreSubscriptionIndexByService(serviceIndex, serviceSubscriptionId)
+	if index == -1 {
+		utils.Warning.Printf("forwardNotification():unknown subscriptionId=%s from service index=%d", serviceSubscriptionId, serviceIndex)
+		return
+	}
+	notificationMap["subscriptionId"] = strconv.Itoa(coreSubscriptionList[index].subscriptionId)
+	sendToTransport(coreSubscriptionList[index].routerId, utils.FinalizeMessage(notificationMap))
+}
+
+func sendToTransport(routerId string, message string) {
+	if !strings.Contains(routerId, "?") {
+		utils.Error.Printf("sendToTransport():no transport manager for RouterId=%s", routerId)
+		return
+	}
+	sendToBackend(extractMgrId(routerId), message)
+}
+
+/**
+* removeTransportSubscriptions terminates the subscriptions of clients of a deregistered transport mgr.
+**/
+func removeTransportSubscriptions(mgrId int) {
+	for i := len(coreSubscriptionList) - 1; i >= 0; i-- {
+		if extractMgrId(coreSubscriptionList[i].routerId) == mgrId {
+			for _, serviceSub := range coreSubscriptionList[i].serviceSubs {
+				sendInternalUnsubscribe(coreSubscriptionList[i].routerId, serviceSub)
+			}
+			removeCoreSubscription(i)
+		}
+	}
+}
+
+/**
+* mergeServiceResponses returns the response to the client. If any of the service managers returned an error, that error is returned.
+**/
+func mergeServiceResponses(pending *PendingRequest_t) map[string]interface{} {
+	var errorIndex = -1
+	for i := 0; i < len(pending.responses); i++ {
+		if pending.responses[i].responseMap["error"] != nil {
+			errorIndex = i
+			break
+		}
+	}
+	switch pending.action {
+	case "subscribe":
+		return mergeSubscribeResponses(pending, errorIndex)
+	case "unsubscribe":
+		if errorIndex == -1 {
+			index := getCoreSubscriptionIndex(pending.subscriptionId)
+			if index != -1 {
+				removeCoreSubscription(index)
+			}
+		}
+		if errorIndex != -1 {
+			return pending.responses[errorIndex].responseMap
+		}
+		responseMap := pending.responses[0].responseMap
+		responseMap["subscriptionId"] = strconv.Itoa(pending.subscriptionId)
+		return responseMap
+	}
+	if errorIndex != -1 {
+		return pending.responses[errorIndex].responseMap
+	}
+	responseMap := pending.responses[0].responseMap
+	if len(pending.responses) > 1 && responseMap["metadata"] != nil { // dynamic metadata, one member per path
+		metadata := make(map[string]interface{})
+		for _, response := range pending.responses {
+			if partMetadata, ok := response.responseMap["metadata"].(map[string]interface{}); ok {
+				for path, pathMetadata := range partMetadata {
+					metadata[path] = pathMetadata
+				}
+			}
+		}
+		responseMap["metadata"] = metadata
+	} else if len(pending.responses) > 1 {
+		var data []interface{}
+		for _, response := range pending.responses {
+			switch partData := response.responseMap["data"].(type) {
+			case []interface{}:
+				data = append(data, partData...)
+			case nil:
+			default:
+				data = append(data, partData)
+			}
+		}
+		responseMap["data"] = data
+	}
+	return responseMap
+}
+
+/**
+* mergeSubscribeResponses creates the core subscription if all service managers accepted the subscription,
+* else the accepted service subscriptions are unsubscribed and the error is returned.
+**/
+func mergeSubscribeResponses(pending *PendingRequest_t, errorIndex int) map[string]interface{} {
+	var serviceSubs []ServiceSubscription_t
+	for _, response := range pending.responses {
+		if subscriptionId, ok := response.responseMap["subscriptionId"].(string); ok {
+			serviceSubs = append(serviceSubs, ServiceSubscription_t{response.serviceIndex, subscriptionId, pending.partRequests[response.serviceIndex]})
+		}
+	}
+	if errorIndex != -1 {
+		for _, serviceSub := range serviceSubs {
+			sendInternalUnsubscribe(pending.routerId, serviceSub)
+		}
+		return pending.responses[errorIndex].responseMap
+	}
+	var coreSubscription CoreSubscription_t
+	coreSubscription.subscriptionId = coreSubscriptionId
+	coreSubscription.routerId = pending.routerId
+	coreSubscription.serviceSubs = serviceSubs
+	coreSubscription.auth = pending.auth
+	coreSubscriptionList = append(coreSubscriptionList, coreSubscription)
+	coreSubscriptionId++
+	responseMap := pending.responses[0].responseMap
+	responseMap["subscriptionId"] = strconv.Itoa(coreSubscription.subscriptionId)
+	return responseMap
+}
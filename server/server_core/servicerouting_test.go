@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func setupTestTransportMgr() *TransportMgr_t {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	mgr := &TransportMgr_t{mgrId: 4711, mgrIndex: 5, backendChan: make(chan string, 1), done: make(chan struct{})}
+	transportMgrMutex.Lock()
+	transportMgrs[mgr.mgrId] = mgr
+	transportMgrMutex.Unlock()
+	registerService("Vehicle", "127.0.0.1")
+	registerService("Vehicle.Private", "127.0.0.1")
+	serviceConnected[0] = true
+	serviceConnected[1] = true
+	return mgr
+}
+
+func teardownTestTransportMgr(mgr *TransportMgr_t) {
+	transportMgrMutex.Lock()
+	delete(transportMgrs, mgr.mgrId)
+	transportMgrMutex.Unlock()
+	delete(serviceConnected, 0)
+	delete(serviceConnected, 1)
+	for key := range pendingRequests {
+		delete(pendingRequests, key)
+	}
+	coreSubscriptionList = nil
+	registeredServices = nil
+	staleServiceSubscriptions = map[int][]string{}
+}
+
+func receiveServiceRequest() chan string {
+	return receiveServiceRequests(1)
+}
+
+/**
+* receiveServiceRequests returns the next requests to the service manager with service index 0, in the order they are sent.
+**/
+func receiveServiceRequests(count int) chan string {
+	serviceRequests := make(chan string, count)
+	go func() {
+		for i := 0; i < count; i++ {
+			serviceRequests <- <-getServiceDataChan(0)
+		}
+	}()
+	return serviceRequests
+}
+
+func TestPendingRequestTimeout(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+
+	requestMap := map[string]interface{}{"RouterId": "4711?1", "action": "subscribe", "path": "Vehicle.Speed", "requestId": "17"}
+	key := addPendingRequest(requestMap, []int{0, 1}, 0, false)
+	processServiceResponse(0, `{"action":"subscribe", "requestId":"`+key+`", "subscriptionId":"3", "ts":"2021-03-01T10:00:00Z"}`)
+
+	internalRequest := receiveServiceRequest()
+	expirePendingRequests(time.Now().Add(serviceRequestTimeout + time.Second))
+
+	response := <-mgr.backendChan
+	if !strings.Contains(response, "504") || !strings.Contains(response, `"requestId":"17"`) {
+		t.Errorf("unexpected timeout response: %s", response)
+	}
+	if request := <-internalRequest; !strings.Contains(request, "unsubscribe") || !strings.Contains(request, `"subscriptionId":"3"`) {
+		t.Errorf("subscription of the responding service manager not terminated: %s", request)
+	}
+	if len(pendingRequests) != 1 { // the internal unsubscribe request
+		t.Errorf("expected 1 pending request, got %d", len(pendingRequests))
+	}
+}
+
+func TestSubscriptionReplay(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+
+	subscribeRequest := map[string]interface{}{"RouterId": "4711?1", "action": "subscribe", "path": "Vehicle.Speed", "requestId": "1"}
+	coreSubscriptionList = append(coreSubscriptionList, CoreSubscription_t{42, "4711?1", []ServiceSubscription_t{{0, "3", subscribeRequest}}, SubscriptionAuth_t{}})
+
+	updateServiceConnection(ServiceConnection_t{0, false})
+	if coreSubscriptionList[0].serviceSubs[0].subscriptionId != "" {
+		t.Fatalf("service subscription id not invalidated at disconnection")
+	}
+	if len(staleServiceSubscriptions[0]) != 1 {
+		t.Fatalf("service subscription id not kept for unsubscription at reconnection: %v", staleServiceSubscriptions)
+	}
+	replayRequests := receiveServiceRequests(2)
+	updateServiceConnection(ServiceConnection_t{0, true})
+	if request := <-replayRequests; !strings.Contains(request, `"action":"unsubscribe"`) || !strings.Contains(request, `"subscriptionId":"3"`) {
+		t.Fatalf("subscription of the dropped data session not unsubscribed before the replay: %s", request)
+	}
+	var requestMap = make(map[string]interface{})
+	utils.MapRequest(<-replayRequests, &requestMap)
+	if requestMap["action"] != "subscribe" || requestMap["path"] != "Vehicle.Speed" {
+		t.Fatalf("unexpected replay request: %v", requestMap)
+	}
+
+	processServiceResponse(0, `{"action":"subscribe", "requestId":"`+requestMap["requestId"].(string)+`", "subscriptionId":"1", "ts":"2021-03-01T10:00:00Z"}`)
+	processServiceResponse(0, `{"action":"subscription", "subscriptionId":"1", "value":"50", "ts":"2021-03-01T10:00:01Z"}`)
+	if notification := <-mgr.backendChan; !strings.Contains(notification, `"subscriptionId":"42"`) {
+		t.Errorf("notification not mapped to the core subscription id: %s", notification)
+	}
+}
+
+func TestSubscriptionReplayTimeout(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+
+	subscribeRequest := map[string]interface{}{"RouterId": "4711?1", "action": "subscribe", "path": "Vehicle.Speed", "requestId": "1"}
+	coreSubscriptionList = append(coreSubscriptionList, CoreSubscription_t{42, "4711?1", []ServiceSubscription_t{{0, "3", subscribeRequest}}, SubscriptionAuth_t{}})
+	updateServiceConnection(ServiceConnection_t{0, false})
+	replayRequests := receiveServiceRequests(2)
+	updateServiceConnection(ServiceConnection_t{0, true})
+	<-replayRequests
+	<-replayRequests
+	processServiceResponse(0, `{"action":"unsubscribe", "requestId":"`+strconv.Itoa(internalRequestId-1)+`", "error":{"number":"400", "reason":"bad_request"}, "ts":"2021-03-01T10:00:00Z"}`) // restarted service manager
+
+	expirePendingRequests(time.Now().Add(serviceRequestTimeout + time.Second))
+	if notification := <-mgr.backendChan; !strings.Contains(notification, `"subscriptionId":"42"`) || !strings.Contains(notification, "gateway_timeout") {
+		t.Errorf("unexpected replay failure notification: %s", notification)
+	}
+	if len(coreSubscriptionList) != 0 {
+		t.Errorf("subscription not terminated after a failed replay: %+v", coreSubscriptionList)
+	}
+}
+
+func TestServiceRegistration(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	defer func() { registeredServices = nil }()
+	for i := 0; i < utils.ServiceDataPortRange; i++ { // one service manager per port of the service data port range
+		index, isReregistration := registerService("Vehicle.Private.OEM"+strconv.Itoa(i), "127.0.0.1")
+		if index != i || isReregistration || getServiceDataChan(index) == nil {
+			t.Fatalf("service manager %d registered with index %d", i, index)
+		}
+	}
+	if index, _ := registerService("Vehicle.Private.Other", "127.0.0.1"); index != -1 {
+		t.Errorf("service manager registered beyond the port range with index %d", index)
+	}
+	if index, isReregistration := registerService("Vehicle.Private.OEM2", "127.0.0.2"); index != 2 || !isReregistration || getServiceRemoteIp(2) != "127.0.0.2" {
+		t.Errorf("restarted service manager registered with index %d", index)
+	}
+}
+
+func TestServiceDataChanFull(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+	for i := 0; i < SERVICE_DATA_CHAN_SIZE; i++ { // the service data session is stuck
+		sendToService(1, `{"action":"get", "path":"Vehicle.Private.Speed", "requestId":"0"}`)
+	}
+
+	requestMap := map[string]interface{}{"RouterId": "4711?1", "action": "get", "requestId": "17"}
+	forwardServiceRequest(requestMap, []ServiceRequestPart_t{{1, []string{"Vehicle.Private.Speed"}}}, SubscriptionAuth_t{})
+	if response := <-mgr.backendChan; !strings.Contains(response, "service_unavailable") || !strings.Contains(response, `"requestId":"17"`) {
+		t.Errorf("unexpected response to a request for a stuck service manager: %s", response)
+	}
+	if len(pendingRequests) != 0 {
+		t.Errorf("%d pending requests left", len(pendingRequests))
+	}
+	request := receiveServiceRequest() // the other service managers are still served
+	forwardServiceRequest(requestMap, []ServiceRequestPart_t{{0, []string{"Vehicle.Speed"}}}, SubscriptionAuth_t{})
+	if !strings.Contains(<-request, "Vehicle.Speed") {
+		t.Errorf("request not forwarded to the service manager that is not stuck")
+	}
+}
@@ -0,0 +1,132 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Subscription tokens:
+* The access token of a subscription to access restricted signals is only verified when the subscription is created.
+* The server hub therefore keeps the token expiry of each such subscription, and when it is passed, the client gets an
+* error notification with number 401 and the subscription is terminated.
+* A client refreshes the token of a live subscription with a subscribe request having the subscriptionId and the new token, but no path:
+* {"action":"subscribe", "subscriptionId":"3", "authorization":"<new token>", "requestId":"8"}
+* The new token is verified by a request worker for the paths and access restriction of the subscription, which are read from the hub
+* via subscriptionTokenChan, as is the new expiry written.
+**/
+
+type SubscriptionAuth_t struct {
+	tokenExpiry time.Time // zero if the subscription is not access restricted
+	paths       string    // the paths the token was verified for
+	validation  int
+}
+
+type SubscriptionTokenRequest_t struct {
+	subscriptionId int
+	routerId       string    // only the client owning the subscription may refresh its token
+	tokenExpiry    time.Time // the expiry of the refreshed token, zero to only read the subscription authorization
+	replyChan      chan SubscriptionTokenReply_t
+}
+
+type SubscriptionTokenReply_t struct {
+	auth  SubscriptionAuth_t
+	found bool
+}
+
+var subscriptionTokenChan = make(chan SubscriptionTokenRequest_t)
+
+func getTokenExpiry(token string) time.Time {
+	exp, err := strconv.Atoi(utils.ExtractFromToken(token, "exp"))
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+/**
+* updateSubscriptionToken is called by the server hub.
+**/
+func updateSubscriptionToken(tokenRequest SubscriptionTokenRequest_t) SubscriptionTokenReply_t {
+	index := getCoreSubscriptionIndex(tokenRequest.subscriptionId)
+	if index == -1 || coreSubscriptionList[index].routerId != tokenRequest.routerId {
+		return SubscriptionTokenReply_t{}
+	}
+	if !tokenRequest.tokenExpiry.IsZero() && !coreSubscriptionList[index].auth.tokenExpiry.IsZero() {
+		coreSubscriptionList[index].auth.tokenExpiry = tokenRequest.tokenExpiry
+		utils.Info.Printf("updateSubscriptionToken():subscriptionId=%d, token expiry=%s", tokenRequest.subscriptionId, tokenRequest.tokenExpiry.UTC().Format(time.RFC3339))
+	}
+	return SubscriptionTokenReply_t{coreSubscriptionList[index].auth, true}
+}
+
+func requestSubscriptionToken(subscriptionId int, routerId string, tokenExpiry time.Time) SubscriptionTokenReply_t {
+	replyChan := make(chan SubscriptionTokenReply_t)
+	subscriptionTokenChan <- SubscriptionTokenRequest_t{subscriptionId, routerId, tokenExpiry, replyChan}
+	return <-replyChan
+}
+
+/**
+* expireSubscriptionTokens is called by the server hub, and terminates the subscriptions having an expired token.
+**/
+func expireSubscriptionTokens(now time.Time) {
+	for i := len(coreSubscriptionList) - 1; i >= 0; i-- {
+		subscription := coreSubscriptionList[i]
+		if subscription.auth.tokenExpiry.IsZero() || now.Before(subscription.auth.tokenExpiry) {
+			continue
+		}
+		utils.Info.Printf("expireSubscriptionTokens():token expired for subscriptionId=%d", subscription.subscriptionId)
+		terminateCoreSubscription(i, utils.ErrorObject(utils.ErrExpiredToken, "The access token has expired, the subscription is terminated."))
+	}
+}
+
+/**
+* refreshSubscriptionToken is called by a request worker for a subscribe request having a subscriptionId.
+**/
+func refreshSubscriptionToken(requestMap map[string]interface{}, mgrId int) {
+	errorResponseMap := newErrorResponseMap()
+	routerId, _ := requestMap["RouterId"].(string)
+	subscriptId, _ := requestMap["subscriptionId"].(string)
+	subscriptionId, err := strconv.Atoi(subscriptId)
+	var reply SubscriptionTokenReply_t
+	if err == nil {
+		reply = requestSubscriptionToken(subscriptionId, routerId, time.Time{})
+	}
+	if !reply.found {
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrInvalidData, "Incorrect or missing subscription id.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	if reply.auth.tokenExpiry.IsZero() {
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "The subscription is not access restricted.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	token := requestMap["authorization"].(string)
+	errorCode := verifyToken(token, "subscribe", reply.auth.paths, reply.auth.validation)
+	utils.CountTokenValidation(errorCode)
+	if errorCode < 0 {
+		setTokenErrorResponse(requestMap, errorResponseMap, errorCode)
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	if !requestSubscriptionToken(subscriptionId, routerId, getTokenExpiry(token)).found { // terminated while the token was verified
+		utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrInvalidData, "Incorrect or missing subscription id.")
+		sendToBackend(mgrId, utils.FinalizeMessage(errorResponseMap))
+		return
+	}
+	responseMap := map[string]interface{}{"RouterId": routerId, "action": "subscribe", "subscriptionId": subscriptId, "ts": utils.GetRfcTime()}
+	if requestMap["requestId"] != nil {
+		responseMap["requestId"] = requestMap["requestId"]
+	}
+	sendToBackend(mgrId, utils.FinalizeMessage(responseMap))
+}
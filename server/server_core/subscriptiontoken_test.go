@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionTokenExpiry(t *testing.T) {
+	mgr := setupTestTransportMgr()
+	defer teardownTestTransportMgr(mgr)
+
+	now := time.Now()
+	subscribeRequest := map[string]interface{}{"RouterId": "4711?1", "action": "subscribe", "path": "Vehicle.Speed", "requestId": "1"}
+	coreSubscriptionList = []CoreSubscription_t{
+		{42, "4711?1", []ServiceSubscription_t{{0, "3", subscribeRequest}}, SubscriptionAuth_t{now.Add(time.Minute), `"Vehicle.Speed"`, 2}},
+		{43, "4711?2", []ServiceSubscription_t{{0, "4", subscribeRequest}}, SubscriptionAuth_t{}}, // not access restricted
+	}
+
+	if reply := updateSubscriptionToken(SubscriptionTokenRequest_t{42, "4711?2", now.Add(time.Hour), nil}); reply.found {
+		t.Errorf("token refreshed by a client not owning the subscription")
+	}
+	reply := updateSubscriptionToken(SubscriptionTokenRequest_t{42, "4711?1", now.Add(time.Hour), nil})
+	if !reply.found || reply.auth.paths != `"Vehicle.Speed"` || !reply.auth.tokenExpiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("token not refreshed: %+v", reply)
+	}
+	expireSubscriptionTokens(now.Add(time.Minute + time.Second)) // after the original expiry
+	if len(coreSubscriptionList) != 2 {
+		t.Fatalf("subscription with a refreshed token terminated")
+	}
+
+	internalRequest := receiveServiceRequest()
+	expireSubscriptionTokens(now.Add(time.Hour + time.Second))
+	notification := <-mgr.backendChan
+	if !strings.Contains(notification, `"subscription"`) || !strings.Contains(notification, `"subscriptionId":"42"`) || !strings.Contains(notification, "expired_token") {
+		t.Errorf("unexpected expiry notification: %s", notification)
+	}
+	if request := <-internalRequest; !strings.Contains(request, "unsubscribe") || !strings.Contains(request, `"subscriptionId":"3"`) {
+		t.Errorf("service subscription not terminated: %s", request)
+	}
+	if len(coreSubscriptionList) != 1 || coreSubscriptionList[0].subscriptionId != 43 {
+		t.Errorf("unexpected subscriptions after expiry: %+v", coreSubscriptionList)
+	}
+}
@@ -0,0 +1,220 @@
+/**
+* (C) 2020 Mitsubishi Electrics Automotive
+* (C) 2019 Geotab Inc
+* (C) 2019 Volvo Cars
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Transport manager registry:
+* Any number of transport managers, of any protocol, may register at runtime.
+* Each registered manager is assigned the lowest free mgrIndex, a data channel server on port transportDataPortNum+mgrIndex,
+* and a mgr ID that is added to the RouterId of the server internal req/resp messages.
+* Messages are routed by the mgr ID, which is taken from a counter and not reused by the next registrations,
+* so that responses in flight for a deregistered manager are dropped, instead of reaching a manager that got the same mgrIndex.
+* A manager is deregistered when its data channel WS session closes, after which it must register again.
+* Messages to a manager are dropped if its channel is full, e.g. if it never opens its data session, so that the server hub is not blocked.
+* The registry is accessed by the registration server, the data channel sessions, and the server hub, so it is mutex protected.
+**/
+
+type TransportMgr_t struct {
+	requestCount uint64 // requests received, atomically updated, first in the struct for 64-bit alignment
+	messageCount uint64 // responses and notifications sent, atomically updated
+	mgrId        int
+	mgrIndex     int
+	protocol     string
+	portNum      int
+	backendChan  chan string   // messages to be sent to the transport mgr
+	done         chan struct{} // closed at deregistration
+	server       *http.Server
+}
+
+var transportMgrs = map[int]*TransportMgr_t{} // key is mgrId
+var transportMgrMutex sync.RWMutex
+var nextMgrId = rand.Intn(65535) // the mgr IDs of a restarted server core differ from those of the previous run
+
+const TRANSPORT_BACKEND_CHAN_SIZE = 10
+
+type TransportMessage_t struct {
+	mgrId   int
+	message string
+}
+
+var transportDataChan = make(chan TransportMessage_t) // requests from all transport mgrs to the server hub
+var transportDeregChan = make(chan int, 10)           // mgr ID of deregistered transport mgrs to the server hub
+
+func isMgrIndexInUse(mgrIndex int) bool {
+	for _, mgr := range transportMgrs {
+		if mgr.mgrIndex == mgrIndex {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* registerTransportMgr allocates a registry entry and starts the data channel server for it.
+* The registration fails if all ports of the transport data port range are in use.
+**/
+func registerTransportMgr(protocol string) (*TransportMgr_t, error) {
+	transportMgrMutex.Lock()
+	defer transportMgrMutex.Unlock()
+	mgrIndex := 0
+	for isMgrIndexInUse(mgrIndex) {
+		mgrIndex++
+	}
+	if mgrIndex == utils.TransportDataPortRange {
+		return nil, fmt.Errorf("max number of transport mgrs, %d, already registered", utils.TransportDataPortRange)
+	}
+	mgrId := nextMgrId // [0 -65535], 16-bit value
+	for transportMgrs[mgrId] != nil {
+		mgrId = (mgrId + 1) % 65535
+	}
+	nextMgrId = (mgrId + 1) % 65535
+	mgr := &TransportMgr_t{mgrId: mgrId, mgrIndex: mgrIndex, protocol: protocol, portNum: transportDataPortNum + mgrIndex}
+	mgr.backendChan = make(chan string, TRANSPORT_BACKEND_CHAN_SIZE)
+	mgr.done = make(chan struct{})
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(mgr.portNum)) // listen before responding, so the mgr can connect directly
+	if err != nil {
+		return nil, err
+	}
+	muxServer := http.NewServeMux()
+	muxServer.HandleFunc(getTransportDataUrlPath(mgrIndex), makeTransportDataHandler(mgr))
+	mgr.server = &http.Server{Handler: muxServer}
+	go func() {
+		err := mgr.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			utils.Error.Printf("Transport data server on port %d failed: %s", mgr.portNum, err)
+		}
+	}()
+	transportMgrs[mgrId] = mgr
+	utils.Info.Printf("registerTransportMgr():protocol=%s, mgrIndex=%d, mgrId=%d, portnum=%d", protocol, mgrIndex, mgrId, mgr.portNum)
+	return mgr, nil
+}
+
+func getTransportDataUrlPath(mgrIndex int) string {
+	return "/transport/data/" + strconv.Itoa(mgrIndex)
+}
+
+/**
+* deregisterTransportMgr removes the transport mgr from the registry, stops its data channel server,
+* and informs the server hub so that its subscriptions can be terminated.
+**/
+func deregisterTransportMgr(mgr *TransportMgr_t) {
+	transportMgrMutex.Lock()
+	if transportMgrs[mgr.mgrId] != mgr {
+		transportMgrMutex.Unlock()
+		return
+	}
+	delete(transportMgrs, mgr.mgrId)
+	close(mgr.done)
+	transportMgrMutex.Unlock()
+	utils.Info.Printf("deregisterTransportMgr():protocol=%s, mgrIndex=%d, mgrId=%d", mgr.protocol, mgr.mgrIndex, mgr.mgrId)
+	mgr.server.Close()
+	transportDeregChan <- mgr.mgrId
+}
+
+func getTransportMgr(mgrId int) *TransportMgr_t {
+	transportMgrMutex.RLock()
+	defer transportMgrMutex.RUnlock()
+	return transportMgrs[mgrId]
+}
+
+/**
+* sendToBackend forwards a message to a transport mgr. The message is dropped if the mgr is not registered,
+* or if its channel is full.
+**/
+func sendToBackend(mgrId int, message string) {
+	mgr := getTransportMgr(mgrId)
+	if mgr == nil {
+		utils.Warning.Printf("sendToBackend():transport mgr ID=%d not registered, message dropped.", mgrId)
+		return
+	}
+	select {
+	case mgr.backendChan <- message:
+		countBackendMessage(message)
+		atomic.AddUint64(&mgr.messageCount, 1)
+	default:
+		utils.Warning.Printf("sendToBackend():transport mgr ID=%d not reading its data channel, message dropped.", mgrId)
+	}
+}
+
+func countTransportRequest(mgrId int) {
+	if mgr := getTransportMgr(mgrId); mgr != nil {
+		atomic.AddUint64(&mgr.requestCount, 1)
+	}
+}
+
+func frontendWSDataSession(conn *websocket.Conn, mgr *TransportMgr_t) {
+	defer conn.Close()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			utils.Error.Print("read error data WS protocol.", err)
+			break
+		}
+
+		utils.Info.Printf("%s request: %s", conn.RemoteAddr(), string(msg))
+		transportDataChan <- TransportMessage_t{mgr.mgrId, string(msg)} // send request to server hub
+	}
+	deregisterTransportMgr(mgr)
+}
+
+func backendWSDataSession(conn *websocket.Conn, mgr *TransportMgr_t) {
+	defer conn.Close()
+	for {
+		select {
+		case message := <-mgr.backendChan:
+			utils.Info.Printf("%s Transport mgr server: message= %s", conn.RemoteAddr(), message)
+			err := conn.WriteMessage(websocket.TextMessage, []byte(message))
+			if err != nil {
+				utils.Error.Print("write error data WS protocol.", err)
+				deregisterTransportMgr(mgr)
+				return
+			}
+		case <-mgr.done:
+			return
+		}
+	}
+}
+
+/**
+*  All transport data servers implement a WS server which communicates with a transport protocol manager.
+**/
+func makeTransportDataHandler(mgr *TransportMgr_t) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") == "websocket" {
+			utils.Info.Printf("we are upgrading to a websocket connection.")
+			upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+			conn, err := upgrader.Upgrade(w, req, nil)
+			if err != nil {
+				utils.Error.Print("upgrade:", err)
+				return
+			}
+			utils.Info.Printf("WS data session initiated, mgrIndex=%d.", mgr.mgrIndex)
+			go frontendWSDataSession(conn, mgr)
+			go backendWSDataSession(conn, mgr)
+		} else {
+			http.Error(w, "400 protocol must be websocket.", 400)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestTransportMgrReregistration(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	transportDataPortNum = 18100
+	defer func() { transportDataPortNum = 8100 }()
+	oldMgr, err := registerTransportMgr("WebSocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deregisterTransportMgr(oldMgr)
+	<-transportDeregChan
+	for i := 0; i < 100; i++ { // the data channel server closes its listener asynchronously
+		if listener, err := net.Listen("tcp", ":"+strconv.Itoa(oldMgr.portNum)); err == nil {
+			listener.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	newMgr, err := registerTransportMgr("WebSocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { deregisterTransportMgr(newMgr); <-transportDeregChan }()
+	if newMgr.mgrIndex != oldMgr.mgrIndex || newMgr.mgrId == oldMgr.mgrId {
+		t.Fatalf("unexpected registration, mgrIndex=%d, mgrId=%d", newMgr.mgrIndex, newMgr.mgrId)
+	}
+
+	sendToBackend(oldMgr.mgrId, `{"action":"get", "requestId":"1", "value":"1", "ts":"2021-03-01T10:00:00Z"}`) // in flight at the deregistration
+	if len(newMgr.backendChan) != 0 {
+		t.Errorf("response for the deregistered manager routed to the new manager")
+	}
+	for i := 0; i < TRANSPORT_BACKEND_CHAN_SIZE+5; i++ { // the new manager does not open its data session
+		sendToBackend(newMgr.mgrId, `{"action":"get", "requestId":"`+strconv.Itoa(i)+`", "value":"1", "ts":"2021-03-01T10:00:00Z"}`)
+	}
+	if len(newMgr.backendChan) != TRANSPORT_BACKEND_CHAN_SIZE {
+		t.Errorf("%d messages queued", len(newMgr.backendChan))
+	}
+}
+
+func TestTransportMgrPortRange(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	transportMgrMutex.Lock()
+	for i := 0; i < utils.TransportDataPortRange; i++ {
+		transportMgrs[20000+i] = &TransportMgr_t{mgrId: 20000 + i, mgrIndex: i}
+	}
+	transportMgrMutex.Unlock()
+	defer func() {
+		transportMgrMutex.Lock()
+		for i := 0; i < utils.TransportDataPortRange; i++ {
+			delete(transportMgrs, 20000+i)
+		}
+		transportMgrMutex.Unlock()
+	}()
+	if mgr, err := registerTransportMgr("WebSocket"); err == nil {
+		t.Errorf("transport mgr registered on port %d, outside the transport data port range", mgr.portNum)
+	}
+}
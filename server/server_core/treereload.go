@@ -0,0 +1,120 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* VSS tree reload:
+* The VSS tree is reloaded when the tree file is updated, or when the server core receives SIGHUP.
+* The new tree is read while requests continue to be served from the current tree, and it is then swapped in under the tree mutex.
+* Requests being served when the tree is swapped complete using the tree they started with, as tree nodes are never modified.
+* Overlay files given by the overlay flag are applied to the new tree, and updates of them also trigger a reload.
+* The path list file is then regenerated. The service manager and the compression code in utils watch the file, and reload it when it is replaced.
+**/
+
+var vssTreeFname = "vss_vissv2.binary" // "vss_vissv2.json" if the treeformat flag is json
+
+var vssOverlayFnames []string
+var vssPathListFname = "../vsspathlist.json" // set from the configuration at startup
+
+var treeWatchInterval = 5 * time.Second
+
+var vssTreeReloadMutex sync.Mutex // reloads are triggered by the tree watcher and the admin server
+var vssTreeLoadTime time.Time     // protected by vssTreeMutex
+var vssTreeReloads int            // protected by vssTreeMutex
+
+func getVssTreeRoot() *treemgr.Node_t {
+	vssTreeMutex.RLock()
+	defer vssTreeMutex.RUnlock()
+	return VSSTreeRoot
+}
+
+/**
+* reloadVssTree returns an error if the tree could not be read, in which case the current tree is kept.
+**/
+func reloadVssTree() (err error) {
+	vssTreeReloadMutex.Lock()
+	defer vssTreeReloadMutex.Unlock()
+	defer func() { // a malformed tree file must not take the server down
+		if r := recover(); r != nil {
+			utils.Error.Printf("reloadVssTree():reading %s failed: %v", vssTreeFname, r)
+			err = fmt.Errorf("reading %s failed: %v", vssTreeFname, r)
+		}
+	}()
+	newTreeRoot, err := treemgr.ReadTree(vssTreeFname, vssOverlayFnames)
+	if err != nil {
+		utils.Error.Printf("reloadVssTree():%s, the current tree is kept", err)
+		return err
+	}
+	vssTreeMutex.Lock()
+	oldTreeRoot := VSSTreeRoot
+	VSSTreeRoot = newTreeRoot
+	vssTreeLoadTime = time.Now()
+	vssTreeReloads++
+	vssTreeMutex.Unlock()
+	treemgr.ReleaseTree(oldTreeRoot)
+	createPathListFile(vssPathListFname)
+	utils.Info.Printf("reloadVssTree():VSS tree reloaded from %s", vssTreeFname)
+	return nil
+}
+
+/**
+* treeModTime returns the latest modification time of the tree file and the overlay files.
+**/
+func treeModTime() time.Time {
+	modTime := utils.FileModTime(vssTreeFname)
+	for _, overlayFname := range vssOverlayFnames {
+		if overlayModTime := utils.FileModTime(overlayFname); overlayModTime.After(modTime) {
+			modTime = overlayModTime
+		}
+	}
+	return modTime
+}
+
+/**
+* watchVssTree reloads the tree on SIGHUP, or when the tree or overlay file modification time has changed, and then been stable for one watch interval.
+**/
+func watchVssTree() {
+	loadedModTime := treeModTime()
+	observedModTime := loadedModTime
+	sighupChan := make(chan os.Signal, 1)
+	signal.Notify(sighupChan, syscall.SIGHUP)
+	ticker := time.NewTicker(treeWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sighupChan:
+			utils.Info.Printf("watchVssTree():SIGHUP received")
+		case <-ticker.C:
+			modTime := treeModTime()
+			if modTime.Equal(loadedModTime) || modTime.IsZero() {
+				continue
+			}
+			if !modTime.Equal(observedModTime) { // the file may still be being written
+				observedModTime = modTime
+				continue
+			}
+			utils.Info.Printf("watchVssTree():tree or overlay file updated")
+		}
+		loadedModTime = treeModTime()
+		observedModTime = loadedModTime
+		reloadVssTree()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/treemgr"
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestReloadVssTree(t *testing.T) {
+	utils.InitLog("servercore-log.txt", "./logs", false, "error")
+	if !initVssFile() {
+		t.Fatal("tree file not found")
+	}
+	oldTreeRoot := getVssTreeRoot()
+	listFname := filepath.Join(t.TempDir(), "vsspathlist.json")
+	vssPathListFname = listFname
+	defer func() { vssPathListFname = "../vsspathlist.json" }()
+	ioutil.WriteFile(listFname+".tmp", []byte(strings.Repeat("x", 1000000)), 0644) // longer than the list
+	createPathListFile(listFname)
+	data, _ := ioutil.ReadFile(listFname)
+	var pathList treemgr.PathList
+	if err := json.Unmarshal(data, &pathList); err != nil || len(pathList.LeafPaths) == 0 {
+		t.Fatalf("path list not regenerated, err=%v", err)
+	}
+
+	reloadVssTree()
+	if getVssTreeRoot() == oldTreeRoot {
+		t.Errorf("tree not swapped")
+	}
+	if matches, _ := searchTree(getVssTreeRoot(), "Vehicle.Speed", false, true, 0, nil, nil); matches != 1 {
+		t.Errorf("search in reloaded tree failed, matches=%d", matches)
+	}
+}
@@ -0,0 +1,150 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Vehicle data backends:
+* The service manager reads and writes signal values through a VehicleDataBackend, selected by the serviceMgr.backend
+* configuration value. A backend is registered by name with a factory function, so a new data source is added by a file
+* in this directory having an init() function that calls registerBackend(), without changes to the service manager itself.
+* A signal that the backend has no value for is served with a dummy value, see readVehicleData().
+**/
+
+type VehicleDataBackend interface {
+	// Get returns the value and timestamp of the signal, or errNoValue if the backend has no value for it.
+	Get(path string) (string, string, error)
+	// Set updates all the signals, or none of them if any update fails, and returns the timestamp of the update.
+	Set(paths []string, values []string) (string, error)
+	// Subscribe makes the backend send the path of every changed signal on changeChan. Set must not block on a full channel,
+	// as it is called by the receiver of the channel. A backend that cannot detect changes returns errChangesNotSupported,
+	// and its signals are then polled.
+	Subscribe(changeChan chan string) error
+	// Metadata returns the backend metadata of the signal.
+	Metadata(path string) DataMetadata
+	Close() error
+}
+
+type DataMetadata struct {
+	Source string // reported as the source item of dynamic metadata
+}
+
+type BackendFactory func(config utils.ServiceMgrConfig) (VehicleDataBackend, error)
+
+var errNoValue = errors.New("no value for the signal")
+var errChangesNotSupported = errors.New("the backend does not support change notifications")
+
+var backendFactories = map[string]BackendFactory{}
+
+var backend VehicleDataBackend // nil if no backend is available, all signals then have dummy values
+
+func registerBackend(name string, factory BackendFactory) {
+	backendFactories[name] = factory
+}
+
+func backendNames() []string {
+	var names []string
+	for name := range backendFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+* newBackend instantiates the backend registered by the name. A factory may return a nil backend without error,
+* e.g. the sqlite backend without a state storage file.
+**/
+func newBackend(config utils.ServiceMgrConfig) (VehicleDataBackend, error) {
+	factory := backendFactories[config.Backend]
+	if factory == nil {
+		return nil, errors.New("unknown vehicle data backend " + config.Backend + ", available backends are " + strings.Join(backendNames(), ", "))
+	}
+	return factory(config)
+}
+
+func init() {
+	registerBackend("memory", newMemoryBackend)
+}
+
+/**
+* The memory backend keeps the latest value of each signal that has been set, and notifies every set signal.
+* It is empty at startup, so the signals have dummy values until they are set.
+**/
+
+type memoryDataPoint struct {
+	value string
+	ts    string
+}
+
+type MemoryBackend struct {
+	mutex       sync.RWMutex
+	dataPoints  map[string]memoryDataPoint
+	changeChans []chan string
+}
+
+func newMemoryBackend(config utils.ServiceMgrConfig) (VehicleDataBackend, error) {
+	return &MemoryBackend{dataPoints: map[string]memoryDataPoint{}}, nil
+}
+
+func (mb *MemoryBackend) Get(path string) (string, string, error) {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+	dataPoint, ok := mb.dataPoints[path]
+	if !ok {
+		return "", "", errNoValue
+	}
+	return dataPoint.value, dataPoint.ts, nil
+}
+
+func (mb *MemoryBackend) Set(paths []string, values []string) (string, error) {
+	if len(paths) != len(values) {
+		return "", errors.New("the number of values differs from the number of paths")
+	}
+	ts := utils.GetRfcTime()
+	mb.mutex.Lock()
+	for i := 0; i < len(paths); i++ {
+		mb.dataPoints[paths[i]] = memoryDataPoint{values[i], ts}
+	}
+	changeChans := mb.changeChans
+	mb.mutex.Unlock()
+	for _, changeChan := range changeChans {
+		for _, path := range paths {
+			select {
+			case changeChan <- path:
+			default:
+				utils.Warning.Printf("MemoryBackend:change notification of %s dropped", path)
+			}
+		}
+	}
+	return ts, nil
+}
+
+func (mb *MemoryBackend) Subscribe(changeChan chan string) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	mb.changeChans = append(mb.changeChans, changeChan)
+	return nil
+}
+
+func (mb *MemoryBackend) Metadata(path string) DataMetadata {
+	return DataMetadata{Source: "memory"}
+}
+
+func (mb *MemoryBackend) Close() error {
+	return nil
+}
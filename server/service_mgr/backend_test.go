@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	mb, err := newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := mb.Get("Vehicle.Speed"); err != errNoValue {
+		t.Errorf("unset signal has a value, err=%v", err)
+	}
+	changeChan := make(chan string, 1)
+	if err := mb.Subscribe(changeChan); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := mb.Set([]string{"Vehicle.Speed", "Vehicle.Cabin.Door.Row1.Left.IsOpen"}, []string{"50", "true"})
+	if err != nil || len(ts) == 0 {
+		t.Fatalf("set failed, err=%v", err)
+	}
+	if value, valueTs, err := mb.Get("Vehicle.Speed"); err != nil || value != "50" || valueTs != ts {
+		t.Errorf("unexpected data point %s %s, err=%v", value, valueTs, err)
+	}
+	if path := <-changeChan; path != "Vehicle.Speed" {
+		t.Errorf("unexpected change notification of %s", path)
+	}
+	if _, err := newBackend(utils.ServiceMgrConfig{Backend: "unknown"}); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
+
+func TestSqliteBackend(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	dbFile := filepath.Join(t.TempDir(), "statestorage.db")
+	if sb, err := newBackend(utils.ServiceMgrConfig{Backend: "sqlite", DbFile: dbFile}); sb != nil || err != nil {
+		t.Fatalf("backend without state storage file, err=%v", err)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("CREATE TABLE VSS_MAP (path TEXT, value TEXT, timestamp TEXT); INSERT INTO VSS_MAP VALUES ('Vehicle.Speed', '10', '2021-03-01T10:00:00Z')"); err != nil {
+		t.Fatal(err)
+	}
+	sb, err := newBackend(utils.ServiceMgrConfig{Backend: "sqlite", DbFile: dbFile})
+	if err != nil || sb == nil {
+		t.Fatalf("backend not created, err=%v", err)
+	}
+	defer sb.Close()
+	if value, ts, err := sb.Get("Vehicle.Speed"); err != nil || value != "10" || ts != "2021-03-01T10:00:00Z" {
+		t.Errorf("unexpected data point %s %s, err=%v", value, ts, err)
+	}
+	if _, _, err := sb.Get("Vehicle.Acceleration.Lateral"); err != errNoValue {
+		t.Errorf("missing signal has a value, err=%v", err)
+	}
+	if _, err := sb.Set([]string{"Vehicle.Speed", "Vehicle.Acceleration.Lateral"}, []string{"20", "1"}); err == nil {
+		t.Error("set of a missing signal accepted")
+	}
+	if value, _, _ := sb.Get("Vehicle.Speed"); value != "10" {
+		t.Errorf("failed set not rolled back, value=%s", value)
+	}
+	changeChan := make(chan string, 10)
+	if err := sb.Subscribe(changeChan); err != nil {
+		t.Fatalf("change log not created, err=%v", err)
+	}
+	if _, err = db.Exec("UPDATE VSS_MAP SET value='30' WHERE path='Vehicle.Speed'"); err != nil { // written by another connection
+		t.Fatal(err)
+	}
+	select {
+	case path := <-changeChan:
+		if path != "Vehicle.Speed" {
+			t.Errorf("unexpected change notification of %s", path)
+		}
+	case <-time.After(time.Second):
+		t.Error("change not notified")
+	}
+}
+
+func TestChangeNotification(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	defer func() { backend = nil }()
+	backend.Set([]string{"Vehicle.Speed"}, []string{"10"})
+	changeFilter, _ := utils.UnpackFilter(map[string]interface{}{"type": "change", "value": map[string]interface{}{"logic-op": "ne", "diff": "0"}})
+	timebasedFilter, _ := utils.UnpackFilter(map[string]interface{}{"type": "timebased", "value": map[string]interface{}{"period": "1"}})
+	subscriptionList := []SubscriptionState{
+		{subscriptionId: 1, subscribers: []Subscriber{{1, "1?1"}}, path: []string{"Vehicle.Speed"}, filterList: changeFilter, latestDataPoints: getLatestDataPoints([]string{"Vehicle.Speed"})},
+		{subscriptionId: 2, subscribers: []Subscriber{{2, "1?2"}}, path: []string{"Vehicle.Speed"}, filterList: timebasedFilter},
+	}
+	backendChan := make(chan string, 10)
+
+	backend.Set([]string{"Vehicle.Speed"}, []string{"10"})
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList)
+	if len(backendChan) != 0 {
+		t.Errorf("unchanged value notified: %s", <-backendChan)
+	}
+	backend.Set([]string{"Vehicle.Speed"}, []string{"20"})
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Cabin.Door.Row1.Left.IsOpen", subscriptionList)
+	if len(backendChan) != 0 {
+		t.Errorf("change of another signal notified: %s", <-backendChan)
+	}
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList)
+	if len(backendChan) != 1 {
+		t.Fatalf("%d notifications of the change", len(backendChan))
+	}
+	if notification := <-backendChan; !strings.Contains(notification, `"subscriptionId":"1"`) || !strings.Contains(notification, `"value":"20"`) {
+		t.Errorf("unexpected notification %s", notification)
+	}
+	if getDPValue(subscriptionList[0].latestDataPoints[0]) != "20" {
+		t.Errorf("latest data point not updated: %s", subscriptionList[0].latestDataPoints[0])
+	}
+}
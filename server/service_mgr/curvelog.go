@@ -340,8 +340,8 @@ func getSleepDuration(newTime time.Time, oldTime time.Time, wantedDuration int)
     return sleepDuration - workDuration
 }
 
-func curveLoggingServer(clChan chan CLPack, threadsChan chan SubThreads, subscriptionId int, opValue string, paths []string) {
-	maxError, bufSize := getCurveLoggingParams(opValue)
+func curveLoggingServer(clChan chan CLPack, threadsChan chan SubThreads, subscriptionId int, curvelogFilter *utils.CurvelogFilter, paths []string) {
+	maxError, bufSize := curvelogFilter.MaxErr, curvelogFilter.BufSize
 	if (bufSize > MAXCLBUFSIZE) {
 	    bufSize = MAXCLBUFSIZE
 	}
@@ -381,6 +381,8 @@ func curveLoggingServer(clChan chan CLPack, threadsChan chan SubThreads, subscri
 }
 
 func clCapture1dim(clChan chan CLPack, subscriptionId int, path string, bufSize int, maxError float64) {
+	clSessionGauge.Inc()
+	defer clSessionGauge.Dec()
     aRingBuffer := createRingBuffer(bufSize+1)  // logic requires buffer to have a size of one larger than needed
     var dpMap = make(map[string]interface{})
     closeClSession := false
@@ -536,6 +538,8 @@ func returnSingleDp3(clChan chan CLPack, subscriptionId int, paths Dim3Elem) {
 
 
 func clCapture2dim(clChan chan CLPack, subscriptionId int, paths Dim2Elem, bufSize int, maxError float64) {
+	clSessionGauge.Inc()
+	defer clSessionGauge.Dec()
     aRingBuffer1 := createRingBuffer(bufSize+1)
     aRingBuffer2 := createRingBuffer(bufSize+1)
     var dpMap1 = make(map[string]interface{})
@@ -659,6 +663,8 @@ func clReduction2Dim(clBuffer1 []CLBufElement, clBuffer2 []CLBufElement, firstIn
 }
 
 func clCapture3dim(clChan chan CLPack, subscriptionId int, paths Dim3Elem, bufSize int, maxError float64) {
+	clSessionGauge.Inc()
+	defer clSessionGauge.Dec()
     aRingBuffer1 := createRingBuffer(bufSize+1)
     aRingBuffer2 := createRingBuffer(bufSize+1)
     aRingBuffer3 := createRingBuffer(bufSize+1)
@@ -0,0 +1,143 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+/**
+* The history store keeps the captured history data points in the time-series table HISTORY of a SQLite database,
+* and the history settings of each created signal in the table HISTORY_SIGNALS, so that both survive a restart of the service manager.
+* The data points of a signal are retained by count, the buffer size, and optionally by age. When the buffer is full,
+* the oldest data point is overwritten, i. e. deleted when a new one is captured. Data points older than the max age are deleted.
+* Without a database file the store is kept in memory, and lost at restart.
+**/
+
+const historyMaxBufSize = 65535   // the buffer size of a signal created with buf-size zero
+const historyMaxFrequency = 65535 // captures per hour
+
+const historySchema = `CREATE TABLE IF NOT EXISTS HISTORY_SIGNALS (path TEXT PRIMARY KEY, bufSize INTEGER, maxAge INTEGER, frequency INTEGER, status INTEGER);
+CREATE TABLE IF NOT EXISTS HISTORY (seq INTEGER PRIMARY KEY AUTOINCREMENT, path TEXT, value TEXT, ts TEXT, tsDay REAL);
+CREATE INDEX IF NOT EXISTS HISTORY_PATH ON HISTORY(path, seq);`
+
+type HistoryStore struct {
+	db *sql.DB
+}
+
+func openHistoryStore(dbFile string) (*HistoryStore, error) {
+	if len(dbFile) == 0 {
+		dbFile = ":memory:"
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open history DB file = %s, err = %s", dbFile, err)
+	}
+	db.SetMaxOpenConns(1) // an in-memory database exists per connection
+	if _, err = db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create the history tables in %s, err = %s", dbFile, err)
+	}
+	return &HistoryStore{db}, nil
+}
+
+/**
+* loadSignals returns the stored settings of the created signals, with the number and the latest timestamp of their data points.
+**/
+func (hs *HistoryStore) loadSignals() ([]HistoryList, error) {
+	rows, err := hs.db.Query(`SELECT s.path, s.bufSize, s.maxAge, s.frequency, s.status, COUNT(h.seq), IFNULL((SELECT ts FROM HISTORY WHERE path=s.path ORDER BY seq DESC LIMIT 1), '')
+		FROM HISTORY_SIGNALS s LEFT JOIN HISTORY h ON h.path=s.path GROUP BY s.path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var signals []HistoryList
+	for rows.Next() {
+		var signal HistoryList
+		err = rows.Scan(&signal.Path, &signal.BufSize, &signal.MaxAge, &signal.Frequency, &signal.Status, &signal.BufCount, &signal.LatestTs)
+		if err != nil {
+			return nil, err
+		}
+		signals = append(signals, signal)
+	}
+	return signals, rows.Err()
+}
+
+func (hs *HistoryStore) saveSignal(signal HistoryList) error {
+	_, err := hs.db.Exec("INSERT OR REPLACE INTO HISTORY_SIGNALS VALUES (?, ?, ?, ?, ?)", signal.Path, signal.BufSize, signal.MaxAge, signal.Frequency, signal.Status)
+	return err
+}
+
+/**
+* deleteSignal deletes the settings and all data points of the signal.
+**/
+func (hs *HistoryStore) deleteSignal(path string) error {
+	_, err := hs.db.Exec("DELETE FROM HISTORY WHERE path=?", path)
+	if err != nil {
+		return err
+	}
+	_, err = hs.db.Exec("DELETE FROM HISTORY_SIGNALS WHERE path=?", path)
+	return err
+}
+
+/**
+* append saves the data point, applies the retention of the signal, and returns the number of data points retained.
+**/
+func (hs *HistoryStore) append(signal HistoryList, value string, ts string) (int, error) {
+	_, err := hs.db.Exec("INSERT INTO HISTORY(path, value, ts, tsDay) VALUES (?, ?, ?, julianday(?))", signal.Path, value, ts, ts)
+	if err != nil {
+		return 0, err
+	}
+	return hs.retain(signal)
+}
+
+/**
+* retain deletes the data points of the signal exceeding its buffer size, oldest first, and those older than its max age, if set.
+**/
+func (hs *HistoryStore) retain(signal HistoryList) (int, error) {
+	_, err := hs.db.Exec(`DELETE FROM HISTORY WHERE path=? AND seq <= (SELECT seq FROM HISTORY WHERE path=? ORDER BY seq DESC LIMIT 1 OFFSET ?)`,
+		signal.Path, signal.Path, signal.BufSize)
+	if err == nil && signal.MaxAge > 0 {
+		_, err = hs.db.Exec("DELETE FROM HISTORY WHERE path=? AND tsDay < julianday('now', ?)", signal.Path, fmt.Sprintf("-%d seconds", signal.MaxAge))
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = hs.db.QueryRow("SELECT COUNT(*) FROM HISTORY WHERE path=?", signal.Path).Scan(&count)
+	return count, err
+}
+
+/**
+* read returns the data points of the path captured at or after since, oldest first, as {"value":"Y", "ts":"Z"}.
+**/
+func (hs *HistoryStore) read(path string, since time.Time) ([]string, error) {
+	rows, err := hs.db.Query("SELECT value, ts FROM HISTORY WHERE path=? AND tsDay >= julianday(?) ORDER BY seq", path, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dataPoints []string
+	for rows.Next() {
+		var value, ts string
+		if err = rows.Scan(&value, &ts); err != nil {
+			return nil, err
+		}
+		dataPoints = append(dataPoints, `{"value":"`+value+`", "ts":"`+ts+`"}`)
+	}
+	return dataPoints, rows.Err()
+}
+
+func (hs *HistoryStore) Close() error {
+	return hs.db.Close()
+}
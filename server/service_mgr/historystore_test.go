@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestHistoryStore(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	dbFile := filepath.Join(t.TempDir(), "history.db")
+	store, err := openHistoryStore(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signal := HistoryList{Path: "Vehicle.Speed", BufSize: 3, Frequency: 3600, Status: 1}
+	if err = store.saveSignal(signal); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	var count int
+	for i, value := range []string{"1", "2", "3", "4"} {
+		count, err = store.append(signal, value, now.Add(time.Duration(i-4)*time.Second).Format(time.RFC3339))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 3 {
+		t.Errorf("%d data points retained in a buffer of 3", count)
+	}
+	dataPoints, _ := store.read("Vehicle.Speed", now.Add(-time.Hour))
+	if len(dataPoints) != 3 || getDPValue(dataPoints[0]) != "2" || getDPValue(dataPoints[2]) != "4" {
+		t.Errorf("oldest data point not overwritten: %v", dataPoints)
+	}
+	if dataPoints, _ = store.read("Vehicle.Speed", now.Add(-2*time.Second)); len(dataPoints) != 2 {
+		t.Errorf("unexpected data points of the period: %v", dataPoints)
+	}
+	store.Close()
+
+	store, err = openHistoryStore(dbFile) // restarted
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	signals, err := store.loadSignals()
+	if err != nil || len(signals) != 1 {
+		t.Fatalf("signals not restored: %v, err=%v", signals, err)
+	}
+	if signals[0].BufSize != 3 || signals[0].Status != 1 || signals[0].BufCount != 3 || signals[0].LatestTs != now.Add(-time.Second).Format(time.RFC3339) {
+		t.Errorf("unexpected restored signal %+v", signals[0])
+	}
+	signal.MaxAge = 3
+	if count, _ = store.retain(signal); count != 2 {
+		t.Errorf("%d data points retained with a max age of 3 seconds", count)
+	}
+	store.deleteSignal("Vehicle.Speed")
+	if signals, _ = store.loadSignals(); len(signals) != 0 {
+		t.Errorf("signal not deleted: %v", signals)
+	}
+}
+
+func TestHistoryCapture(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	historyStore, _ = openHistoryStore("")
+	historyScheduler = newScheduler()
+	historyList = []HistoryList{{Path: "Vehicle.Speed"}}
+	defer func() { backend = nil; historyStore.Close(); historyList = nil }()
+
+	if processHistoryCtrl(`{"action":"create", "path":"Vehicle.Speed", "buf-size":"2"}`, true) != "200 OK" {
+		t.Fatal("history buffer not created")
+	}
+	for _, frequency := range []string{"0", "-1", "3600001"} { // zero would divide by zero, and the others capture every millisecond
+		if status := processHistoryCtrl(`{"action":"start", "path":"Vehicle.Speed", "frequency":"`+frequency+`"}`, true); status != "400 Bad Request" {
+			t.Errorf("frequency %s accepted with %s", frequency, status)
+		}
+	}
+	if status := processHistoryCtrl(`{"action":"start", "path":"Vehicle.Unknown", "frequency":"60"}`, true); status != "404 Not Found" {
+		t.Errorf("unknown path accepted with %s", status)
+	}
+	now := time.Now().UTC()
+	for i, value := range []string{"10", "20", "30"} { // the backend timestamps have a resolution of one second
+		backend.(*MemoryBackend).dataPoints["Vehicle.Speed"] = memoryDataPoint{value, now.Add(time.Duration(i-3) * time.Second).Format(time.RFC3339)}
+		captureHistoryValue(0)
+		captureHistoryValue(0) // unchanged timestamp, not saved
+	}
+	if historyList[0].BufCount != 2 {
+		t.Errorf("%d data points captured in a buffer of 2", historyList[0].BufCount)
+	}
+	response := processHistoryGet(`{"path":"Vehicle.Speed", "period":"0000-01-01T01:00:00Z"}`)
+	if !strings.Contains(response, `"value":"20"`) || !strings.Contains(response, `"value":"30"`) || strings.Contains(response, `"value":"10"`) {
+		t.Errorf("unexpected history %s", response)
+	}
+	if processHistoryCtrl(`{"action":"delete", "path":"Vehicle.Speed"}`, true) != "200 OK" || len(processHistoryGet(`{"path":"Vehicle.Speed", "period":"0000-01-01T01:00:00Z"}`)) != 0 {
+		t.Errorf("history buffer not deleted")
+	}
+}
@@ -0,0 +1,151 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Dynamic metadata:
+* Runtime information per signal, returned for get requests having a dynamic-metadata filter.
+* The update rate is the rate observed by the service manager, i. e. it is calculated from the distinct
+* state storage timestamps of the data points read by the service manager, for requests, subscriptions, and history capture.
+**/
+
+const (
+	DYNMETA_LAST_UPDATE   = "lastUpdate"
+	DYNMETA_UPDATE_RATE   = "updateRate"
+	DYNMETA_SOURCE        = "source"
+	DYNMETA_SUBSCRIPTIONS = "subscriptions"
+	DYNMETA_HISTORY       = "history"
+)
+
+var dynamicMetadataItems = []string{DYNMETA_LAST_UPDATE, DYNMETA_UPDATE_RATE, DYNMETA_SOURCE, DYNMETA_SUBSCRIPTIONS, DYNMETA_HISTORY}
+
+type UpdateStatistics struct {
+	firstTs time.Time
+	lastTs  time.Time
+	updates int // number of distinct timestamps observed after firstTs
+}
+
+var updateStatistics = map[string]*UpdateStatistics{}
+var updateStatisticsMutex sync.Mutex // data points are read both by the main loop and the history server
+
+var historyStatusChannel chan string
+
+func recordDataPointTs(path string, ts string) {
+	timestamp, err := convertFromIsoTime(ts)
+	if err != nil {
+		return
+	}
+	updateStatisticsMutex.Lock()
+	defer updateStatisticsMutex.Unlock()
+	statistics := updateStatistics[path]
+	if statistics == nil {
+		updateStatistics[path] = &UpdateStatistics{firstTs: timestamp, lastTs: timestamp}
+		return
+	}
+	if timestamp.After(statistics.lastTs) {
+		statistics.lastTs = timestamp
+		statistics.updates++
+	}
+}
+
+func getUpdateStatistics(path string) (string, string) { // returns last update ts, and updates per second
+	updateStatisticsMutex.Lock()
+	defer updateStatisticsMutex.Unlock()
+	statistics := updateStatistics[path]
+	if statistics == nil {
+		return "", ""
+	}
+	lastUpdate := statistics.lastTs.Format(time.RFC3339Nano)
+	period := statistics.lastTs.Sub(statistics.firstTs).Seconds()
+	if statistics.updates == 0 || period <= 0 {
+		return lastUpdate, ""
+	}
+	return lastUpdate, strconv.FormatFloat(float64(statistics.updates)/period, 'f', 3, 64)
+}
+
+func countSubscriptions(path string, subscriptionList []SubscriptionState) int {
+	count := 0
+	for i := 0; i < len(subscriptionList); i++ {
+		for _, subscribedPath := range subscriptionList[i].path {
+			if subscribedPath == path {
+				count += len(subscriptionList[i].subscribers)
+				break
+			}
+		}
+	}
+	return count
+}
+
+func getHistoryStatus(path string) string {
+	historyStatusChannel <- path
+	return <-historyStatusChannel
+}
+
+func getDynamicMetadataItem(item string, path string, subscriptionList []SubscriptionState) string {
+	switch item {
+	case DYNMETA_LAST_UPDATE:
+		lastUpdate, _ := getUpdateStatistics(path)
+		return lastUpdate
+	case DYNMETA_UPDATE_RATE:
+		_, updateRate := getUpdateStatistics(path)
+		return updateRate
+	case DYNMETA_SOURCE:
+		_, isDummy := readVehicleData(path)
+		if isDummy {
+			return "dummy"
+		}
+		return backend.Metadata(path).Source
+	case DYNMETA_SUBSCRIPTIONS:
+		return strconv.Itoa(countSubscriptions(path, subscriptionList))
+	case DYNMETA_HISTORY:
+		return getHistoryStatus(path)
+	}
+	return ""
+}
+
+/**
+* getDynamicMetadata returns the metadata object {"path1":{"item1":"X", ...}, ...} for the requested items, or all items if none is requested.
+**/
+func getDynamicMetadata(pathArray []string, metadataFilter *utils.DynamicMetadataFilter, subscriptionList []SubscriptionState) (string, error) {
+	items := metadataFilter.Items
+	if len(items) == 0 {
+		items = dynamicMetadataItems
+	}
+	for _, item := range items {
+		isKnown := false
+		for _, knownItem := range dynamicMetadataItems {
+			if item == knownItem {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			return "", errors.New("Unknown dynamic metadata item " + item + ".")
+		}
+	}
+	var pathMetadata []string
+	for _, path := range pathArray {
+		var itemMetadata []string
+		for _, item := range items {
+			itemMetadata = append(itemMetadata, `"`+item+`":"`+getDynamicMetadataItem(item, path, subscriptionList)+`"`)
+		}
+		pathMetadata = append(pathMetadata, `"`+path+`":{`+strings.Join(itemMetadata, ", ")+`}`)
+	}
+	return "{" + strings.Join(pathMetadata, ", ") + "}", nil
+}
@@ -0,0 +1,75 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+/**
+* Service manager metrics, exposed in addition to the request and notification metrics of utils.
+**/
+
+var subscriptionGauge = utils.NewGauge("vissv2_subscriptions", "Active subscriptions by filter type, a subscription having multiple filter types is counted for each.", "filter")
+var samplingGauge = utils.NewGauge("vissv2_subscription_samplings", "Active subscription samplings, each shared by the subscriptions having identical path and filter.")
+var clSessionGauge = utils.NewGauge("vissv2_curvelog_sessions", "Active curve logging capture sessions.")
+var historyFillGauge = utils.NewGauge("vissv2_history_buffer_fill_ratio", "Part of the history buffer of a signal that is filled, from 0 to 1.", "path")
+
+var subscriptionFilterTypes = []string{utils.FILTER_PATHS, utils.FILTER_TIMEBASED, utils.FILTER_RANGE, utils.FILTER_CHANGE, utils.FILTER_CURVELOG}
+
+/**
+* getMetricsPort returns the metrics port of the service manager, offset by its service index as its data channel port is,
+* so that service managers on the same host do not collide.
+**/
+func getMetricsPort(regResponse RegResponse) int {
+	if utils.Config.MetricsPorts.ServiceMgr == 0 {
+		return 0
+	}
+	return utils.Config.MetricsPorts.ServiceMgr + regResponse.Portnum - utils.Config.Ports.ServiceData
+}
+
+/**
+* updateSubscriptionMetrics is called by the main loop when the subscription list may have changed, after a request or a curve logging notification,
+* and not at the sampling events, as it walks the list.
+**/
+func updateSubscriptionMetrics(subscriptionList []SubscriptionState) {
+	for _, filterType := range subscriptionFilterTypes {
+		count := 0
+		for i := 0; i < len(subscriptionList); i++ {
+			if getOpType(subscriptionList[i].filterList, filterType) {
+				count += len(subscriptionList[i].subscribers)
+			}
+		}
+		subscriptionGauge.Set(float64(count), filterType)
+	}
+	samplingGauge.Set(float64(len(subscriptionList)))
+}
+
+/**
+* updateHistoryMetrics is called by the history server when the buffer of a signal is created, written, or deleted.
+**/
+func updateHistoryMetrics(signalId int) {
+	if historyList[signalId].BufSize == 0 {
+		historyFillGauge.Delete(historyList[signalId].Path)
+		return
+	}
+	historyFillGauge.Set(float64(historyList[signalId].BufCount)/float64(historyList[signalId].BufSize), historyList[signalId].Path)
+}
+
+/**
+* sendNotification does not block the main loop while the server core is not connected, the notification is then dropped.
+**/
+func sendNotification(backendChannel chan string, notification string) {
+	utils.CountNotification()
+	select {
+	case backendChannel <- notification:
+	default:
+		utils.Warning.Printf("sendNotification():backend channel full, notification dropped=%s", notification)
+	}
+}
@@ -0,0 +1,185 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+/**
+* Scheduler:
+* Periodic timebased subscriptions and history captures are scheduled by one Scheduler each, without a limit on their number.
+* Members having the same period are coalesced into one period group, which is scheduled as one entry of a heap ordered by
+* the next due time, so a tick costs O(log(number of distinct periods)), however many members there are.
+* When a group is due, the ids of all its members are sent together on C, so that the receiver can sample each signal once
+* for all of them. A member added to an existing group is first due at the next tick of the group, which may be earlier than one period.
+* Add and Remove never wait for the receiver of C.
+**/
+
+const minSchedulerPeriod = time.Millisecond
+
+type periodGroup struct {
+	period    time.Duration
+	due       time.Time
+	members   map[int]bool
+	heapIndex int
+}
+
+type groupHeap []*periodGroup
+
+func (gh groupHeap) Len() int           { return len(gh) }
+func (gh groupHeap) Less(i, j int) bool { return gh[i].due.Before(gh[j].due) }
+func (gh groupHeap) Swap(i, j int) {
+	gh[i], gh[j] = gh[j], gh[i]
+	gh[i].heapIndex = i
+	gh[j].heapIndex = j
+}
+func (gh *groupHeap) Push(x interface{}) {
+	group := x.(*periodGroup)
+	group.heapIndex = len(*gh)
+	*gh = append(*gh, group)
+}
+func (gh *groupHeap) Pop() interface{} {
+	old := *gh
+	group := old[len(old)-1]
+	*gh = old[:len(old)-1]
+	return group
+}
+
+type Scheduler struct {
+	C        chan []int // the ids of the members that are due
+	mutex    sync.Mutex
+	groups   map[time.Duration]*periodGroup
+	periods  map[int]time.Duration // the period of each member
+	dueOrder groupHeap
+	wakeChan chan struct{}
+}
+
+func NewScheduler() *Scheduler {
+	scheduler := newScheduler()
+	go scheduler.run()
+	return scheduler
+}
+
+func newScheduler() *Scheduler {
+	return &Scheduler{C: make(chan []int), groups: map[time.Duration]*periodGroup{}, periods: map[int]time.Duration{}, wakeChan: make(chan struct{}, 1)}
+}
+
+/**
+* Add schedules the member id with the period, replacing an earlier period of the id. The period is at least minSchedulerPeriod.
+**/
+func (s *Scheduler) Add(id int, period time.Duration) {
+	if period < minSchedulerPeriod {
+		period = minSchedulerPeriod
+	}
+	s.mutex.Lock()
+	s.remove(id)
+	group := s.groups[period]
+	if group == nil {
+		group = &periodGroup{period: period, due: time.Now().Add(period), members: map[int]bool{}}
+		s.groups[period] = group
+		heap.Push(&s.dueOrder, group)
+	}
+	group.members[id] = true
+	s.periods[id] = period
+	s.mutex.Unlock()
+	s.wake()
+}
+
+/**
+* Remove unschedules the member id. Its id may still be received once, if its group was due while it was removed.
+**/
+func (s *Scheduler) Remove(id int) {
+	s.mutex.Lock()
+	s.remove(id)
+	s.mutex.Unlock()
+	s.wake()
+}
+
+func (s *Scheduler) remove(id int) {
+	period, ok := s.periods[id]
+	if !ok {
+		return
+	}
+	delete(s.periods, id)
+	group := s.groups[period]
+	delete(group.members, id)
+	if len(group.members) == 0 {
+		heap.Remove(&s.dueOrder, group.heapIndex)
+		delete(s.groups, period)
+	}
+}
+
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.periods)
+}
+
+func (s *Scheduler) wake() {
+	select {
+	case s.wakeChan <- struct{}{}:
+	default: // already woken
+	}
+}
+
+/**
+* dispatchDue returns the member ids of each group that is due at now, and schedules the groups for their next tick.
+* A group that is more than one period late skips the missed ticks. It also returns the time until the next group is due.
+**/
+func (s *Scheduler) dispatchDue(now time.Time) ([][]int, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var dueIds [][]int
+	for len(s.dueOrder) > 0 && !s.dueOrder[0].due.After(now) {
+		group := s.dueOrder[0]
+		ids := make([]int, 0, len(group.members))
+		for id := range group.members {
+			ids = append(ids, id)
+		}
+		dueIds = append(dueIds, ids)
+		group.due = group.due.Add(group.period)
+		if !group.due.After(now) {
+			group.due = now.Add(group.period)
+		}
+		heap.Fix(&s.dueOrder, 0)
+	}
+	if len(s.dueOrder) == 0 {
+		return dueIds, -1
+	}
+	return dueIds, s.dueOrder[0].due.Sub(now)
+}
+
+func (s *Scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	for {
+		dueIds, wait := s.dispatchDue(time.Now())
+		if len(dueIds) > 0 {
+			for _, ids := range dueIds {
+				s.C <- ids
+			}
+			continue // the sending may have been delayed by the receiver
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-s.wakeChan:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+)
+
+func TestScheduler(t *testing.T) {
+	scheduler := NewScheduler()
+	for id := 1; id <= 300; id++ { // beyond the former limit of 255 tickers
+		scheduler.Add(id, 20*time.Millisecond)
+	}
+	scheduler.Add(1000, time.Hour)
+	select {
+	case ids := <-scheduler.C:
+		if len(ids) != 300 {
+			t.Errorf("%d of 300 members with the same period due together", len(ids))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("period group not due")
+	}
+	for id := 1; id <= 300; id++ {
+		scheduler.Remove(id)
+	}
+	if scheduler.Len() != 1 {
+		t.Errorf("members not removed, %d members", scheduler.Len())
+	}
+}
+
+func TestSchedulerDispatch(t *testing.T) {
+	scheduler := newScheduler()
+	scheduler.Add(1, 2*time.Second)
+	scheduler.Add(2, time.Second)
+	scheduler.Add(3, time.Second)
+	start := scheduler.groups[time.Second].due.Add(-time.Second)
+	if dueIds, wait := scheduler.dispatchDue(start); len(dueIds) != 0 || wait != time.Second {
+		t.Errorf("unexpected dispatch %v, next in %s", dueIds, wait)
+	}
+	dueIds, _ := scheduler.dispatchDue(start.Add(time.Second))
+	if len(dueIds) != 1 || len(dueIds[0]) != 2 {
+		t.Fatalf("unexpected dispatch %v", dueIds)
+	}
+	sort.Ints(dueIds[0])
+	if dueIds[0][0] != 2 || dueIds[0][1] != 3 {
+		t.Errorf("unexpected members due %v", dueIds[0])
+	}
+	if dueIds, _ = scheduler.dispatchDue(start.Add(5 * time.Second)); len(dueIds) != 2 { // late, the missed ticks are skipped
+		t.Errorf("unexpected late dispatch %v", dueIds)
+	}
+	if _, wait := scheduler.dispatchDue(start.Add(5 * time.Second)); wait != time.Second {
+		t.Errorf("next tick not one period after the late dispatch, but in %s", wait)
+	}
+}
+
+/**
+* The benchmarks process 1000 members per operation, so ns/op is the CPU cost per thousand subscriptions.
+**/
+
+func addBenchmarkMembers(scheduler *Scheduler, numOfPeriods int) {
+	for id := 0; id < 1000; id++ {
+		scheduler.Add(id, time.Duration(1+id%numOfPeriods)*time.Second)
+	}
+}
+
+func BenchmarkSchedulerAddRemove1000(b *testing.B) {
+	scheduler := newScheduler()
+	for i := 0; i < b.N; i++ {
+		addBenchmarkMembers(scheduler, 10)
+		for id := 0; id < 1000; id++ {
+			scheduler.Remove(id)
+		}
+	}
+}
+
+func benchmarkSchedulerTick(b *testing.B, numOfPeriods int) {
+	scheduler := newScheduler()
+	addBenchmarkMembers(scheduler, numOfPeriods)
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now = now.Add(time.Duration(numOfPeriods) * time.Second) // all members are due
+		scheduler.dispatchDue(now)
+	}
+}
+
+func BenchmarkSchedulerTick1000SamePeriod(b *testing.B) {
+	benchmarkSchedulerTick(b, 1)
+}
+
+func BenchmarkSchedulerTick1000In10Periods(b *testing.B) {
+	benchmarkSchedulerTick(b, 10)
+}
+
+func BenchmarkSchedulerTick1000DistinctPeriods(b *testing.B) {
+	benchmarkSchedulerTick(b, 1000)
+}
+
+/**
+* BenchmarkIntervalNotifications1000 includes the sampling of the memory backend and the notification creation,
+* for 1000 subscriptions due together on 10 signals.
+**/
+func BenchmarkIntervalNotifications1000(b *testing.B) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	defer func() { backend = nil }()
+	subscriptionList := make([]SubscriptionState, 1000)
+	subscriptionIds := make([]int, 1000)
+	for i := range subscriptionList {
+		path := "Vehicle.Signal" + strconv.Itoa(i%10)
+		backend.Set([]string{path}, []string{strconv.Itoa(i)})
+		subscriptionList[i] = SubscriptionState{subscriptionId: i + 1, subscribers: []Subscriber{{i + 1, "1?" + strconv.Itoa(i)}}, path: []string{path}}
+		subscriptionIds[i] = i + 1
+	}
+	backendChan := make(chan string, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sendIntervalNotifications(backendChan, subscriptionIds, subscriptionList)
+		for len(backendChan) > 0 {
+			<-backendChan
+		}
+	}
+}
@@ -11,22 +11,20 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	//	"sync"
+	"sync"
 	"time"
 
 	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
 	"github.com/akamensky/argparse"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // one muxServer component for service registration, one for the data communication
@@ -40,13 +38,23 @@ type RegResponse struct {
 	Urlpath string
 }
 
+type Subscriber struct {
+	subscriptionId int
+	routerId       string
+}
+
+/**
+* A SubscriptionState is the sampling of one path and filter combination, shared by all clients subscribing to the same combination.
+* Its subscriptionId is the id of the first subscriber, which identifies the sampling in the scheduler and the curve logging.
+**/
 type SubscriptionState struct {
 	subscriptionId      int
 	SubscriptionThreads int  //only used by subs that spawn multiple threads that return notifications
-	routerId            string
+	subscribers         []Subscriber
+	samplingKey         string // the path and filter of the subscribe request
 	path                []string
 	filterList          []utils.FilterObject
-	latestDataPoint     string
+	latestDataPoints    []string // the latest notified data point of each path, for the change filter
 }
 
 var subscriptionId int
@@ -55,12 +63,16 @@ type HistoryList struct {
 	Path      string
 	Frequency int
 	BufSize   int
+	MaxAge    int // seconds, zero if the data points are only retained by count
 	Status    int
-	BufIndex  int // points to next empty buffer element
-	Buffer    []string
+	BufCount  int    // number of data points in the history store
+	LatestTs  string // timestamp of the latest captured data point
 }
 
 var historyList []HistoryList
+var historyStore *HistoryStore
+
+const historyRetentionInterval = 10 * time.Second // the max age of the history data points is applied also when not capturing
 var historyAccessChannel chan string
 
 var hostIp string
@@ -73,14 +85,16 @@ var errorResponseMap = map[string]interface{}{
 	"ts":        "yy",
 }
 
-var db *sql.DB
-var dbErr error
-var isStateStorage = false
+const DEFAULT_ROOT_NODE = "Vehicle"
+const DEFAULT_UDS_PATH = "/tmp/vissv2/histctrlserver.sock"
+
+const CHANGE_CHAN_SIZE = 1000 // a change notification of the memory backend is dropped when the channel is full
+const BACKEND_CHAN_SIZE = 10  // a notification is dropped when the channel is full, e.g. while the server core is not connected
 
 var dummyValue int // dummy value returned when nothing better is available. Counts from 0 to 999, wrap around, updated every 50 msec
 
 func registerAsServiceMgr(regRequest RegRequest, regResponse *RegResponse) int {
-	url := "http://" + hostIp + ":8082/service/reg"
+	url := "http://" + hostIp + ":" + strconv.Itoa(utils.Config.Ports.ServiceReg) + "/service/reg"
 	utils.Info.Printf("ServerCore URL %s", url)
 
 	data := []byte(`{"Rootnode": "` + regRequest.Rootnode + `"}`)
@@ -92,7 +106,7 @@ func registerAsServiceMgr(regRequest RegRequest, regResponse *RegResponse) int {
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Host", hostIp+":8082")
+	req.Header.Set("Host", hostIp+":"+strconv.Itoa(utils.Config.Ports.ServiceReg))
 
 	// Set client timeout
 	client := &http.Client{Timeout: time.Second * 10}
@@ -127,7 +141,27 @@ func registerAsServiceMgr(regRequest RegRequest, regResponse *RegResponse) int {
 	return 1
 }
 
+/**
+* makeServiceDataHandler returns the handler of the data sessions of the server core. When the server core reconnects,
+* the previous session is closed and its goroutines have stopped before the new session starts, so that no notification
+* is read by a stale session. The notifications queued for the previous session are dropped.
+**/
+/**
+* getInstanceFileName returns the file name used by the service manager serving the root node. The service manager of the default root node
+* uses the configured file name, the others have the root node appended to it, so that service managers on the same host do not share files.
+**/
+func getInstanceFileName(fname string, rootNode string) string {
+	if len(fname) == 0 || rootNode == DEFAULT_ROOT_NODE {
+		return fname
+	}
+	extension := filepath.Ext(fname)
+	return strings.TrimSuffix(fname, extension) + "-" + rootNode + extension
+}
+
 func makeServiceDataHandler(dataChannel chan string, backendChannel chan string) func(http.ResponseWriter, *http.Request) {
+	var sessionMutex sync.Mutex
+	var closeSession func() error // of the current session, nil before the first session
+	var sessionStopped chan struct{}
 	return func(w http.ResponseWriter, req *http.Request) {
 		if req.Header.Get("Upgrade") == "websocket" {
 			utils.Info.Printf("we are upgrading to a websocket connection.\n")
@@ -137,8 +171,27 @@ func makeServiceDataHandler(dataChannel chan string, backendChannel chan string)
 				utils.Error.Printf("upgrade: %s", err)
 				return
 			}
-			go utils.FrontendWSdataSession(conn, dataChannel, backendChannel)
-			go utils.BackendWSdataSession(conn, backendChannel)
+			sessionMutex.Lock()
+			defer sessionMutex.Unlock()
+			if closeSession != nil {
+				closeSession()
+				<-sessionStopped
+			}
+			for len(backendChannel) > 0 {
+				utils.Warning.Printf("makeServiceDataHandler():notification to the previous session dropped=%s", <-backendChannel)
+			}
+			closeSession = conn.Close
+			sessionStopped = make(chan struct{})
+			frontendStopped := make(chan struct{})
+			go func() {
+				utils.FrontendWSdataSession(conn, dataChannel, backendChannel)
+				close(frontendStopped)
+			}()
+			go func(stopped chan struct{}) {
+				utils.BackendWSdataSession(conn, backendChannel, frontendStopped)
+				<-frontendStopped
+				close(stopped)
+			}(sessionStopped)
 		} else {
 			utils.Warning.Printf("Client must set up a Websocket session.\n")
 		}
@@ -152,65 +205,27 @@ func initDataServer(muxServer *http.ServeMux, dataChannel chan string, backendCh
 	utils.Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(regResponse.Portnum), muxServer))
 }
 
-const MAXTICKERS = 255 // total number of active subscription and history tickers
-var subscriptionTicker [MAXTICKERS]*time.Ticker
-var historyTicker [MAXTICKERS]*time.Ticker
-var tickerIndexList [MAXTICKERS]int
+var subscriptionScheduler *Scheduler // the timebased subscriptions, by subscription id
+var historyScheduler *Scheduler      // the history captures, by history list index
 
-func allocateTicker(subscriptionId int) int {
-	for i := 0; i < len(tickerIndexList); i++ {
-		if tickerIndexList[i] == 0 {
-			tickerIndexList[i] = subscriptionId
-			return i
-		}
-	}
-	return -1
-}
-
-func deallocateTicker(subscriptionId int) int {
-	for i := 0; i < len(tickerIndexList); i++ {
-		if tickerIndexList[i] == subscriptionId {
-			tickerIndexList[i] = 0
-			return i
-		}
-	}
-	return -1
+func activateInterval(subscriptionId int, interval int) {
+	subscriptionScheduler.Add(subscriptionId, time.Duration(interval)*time.Second) // interval in seconds
 }
 
-func activateInterval(subscriptionChannel chan int, subscriptionId int, interval int) {
-	index := allocateTicker(subscriptionId)
-	if index == -1 {
-		utils.Error.Printf("activateInterval: No available ticker.")
-		return
-	}
-	subscriptionTicker[index] = time.NewTicker(time.Duration(interval) * 1000 * time.Millisecond) // interval in seconds
-	go func() {
-		for range subscriptionTicker[index].C {
-			subscriptionChannel <- subscriptionId
-		}
-	}()
+func deactivateInterval(subscriptionId int) {
+	subscriptionScheduler.Remove(subscriptionId)
 }
 
-func deactivateInterval(subscriptionId int) {
-	subscriptionTicker[deallocateTicker(subscriptionId)].Stop()
+func isValidHistoryFrequency(frequency int) bool {
+	return frequency > 0 && frequency <= historyMaxFrequency
 }
 
-func activateHistory(historyChannel chan int, signalId int, frequency int) {
-	index := allocateTicker(signalId)
-	if index == -1 {
-		utils.Error.Printf("activateHistory: No available ticker.")
-		return
-	}
-	historyTicker[index] = time.NewTicker(time.Duration((3600*1000)/frequency) * time.Millisecond) // freq in cycles per hour
-	go func() {
-		for range historyTicker[index].C {
-			historyChannel <- signalId
-		}
-	}()
+func activateHistory(signalId int, frequency int) {
+	historyScheduler.Add(signalId, time.Duration((3600*1000)/frequency)*time.Millisecond) // freq in cycles per hour
 }
 
 func deactivateHistory(signalId int) {
-	historyTicker[deallocateTicker(signalId)].Stop()
+	historyScheduler.Remove(signalId)
 }
 
 func getSubcriptionStateIndex(subscriptionId int, subscriptionList []SubscriptionState) int {
@@ -229,16 +244,99 @@ func setSubscriptionListThreads(subscriptionList []SubscriptionState, subThreads
 	return subscriptionList
 }
 
+/**
+* checkRangeChangeFilter returns true if all range and change filters of the list are satisfied, i. e. the filters are combined
+* with AND semantics. A list without range and change filters is satisfied.
+**/
 func checkRangeChangeFilter(filterList []utils.FilterObject, latestDataPoint string, currentDataPoint string) bool {
 	for i := 0; i < len(filterList); i++ {
-		if filterList[i].Type == "paths" || filterList[i].Type == "timebased" || filterList[i].Type == "curvelog" {
+		if filterList[i].Type == utils.FILTER_RANGE && !evaluateRangeFilter(filterList[i].Range, getDPValue(currentDataPoint)) {
+			return false
+		}
+		if filterList[i].Type == utils.FILTER_CHANGE && !evaluateChangeFilter(filterList[i].Change, getDPValue(latestDataPoint), getDPValue(currentDataPoint)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasRangeChangeFilter(filterList []utils.FilterObject) bool {
+	return getOpType(filterList, utils.FILTER_RANGE) || getOpType(filterList, utils.FILTER_CHANGE)
+}
+
+/**
+* isValueTriggered returns true if the notifications of a subscription are triggered by value changes, and not by an interval or curve logging,
+* which are then gated by the range and change filters.
+**/
+func isValueTriggered(filterList []utils.FilterObject) bool {
+	return hasRangeChangeFilter(filterList) && !getOpType(filterList, utils.FILTER_TIMEBASED) && !getOpType(filterList, utils.FILTER_CURVELOG)
+}
+
+/**
+* evaluateRangeChange returns the paths of the subscription, or only changedPath if it is not empty, having a current value that satisfies
+* the range and change filters, and updates their latest data points. The values are read via the dataPoints cache, so that each signal
+* is read once for all subscriptions evaluated together.
+**/
+func evaluateRangeChange(subscriptionState *SubscriptionState, changedPath string, dataPoints map[string]string) []string {
+	var triggerPaths []string
+	for i, path := range subscriptionState.path {
+		if len(changedPath) > 0 && path != changedPath {
 			continue
 		}
-		if filterList[i].Type == "range" {
-			return evaluateRangeFilter(filterList[i].Value, getDPValue(currentDataPoint))
+		dataPoint := getSampledDataPoint(path, dataPoints)
+		if checkRangeChangeFilter(subscriptionState.filterList, subscriptionState.latestDataPoints[i], dataPoint) {
+			subscriptionState.latestDataPoints[i] = dataPoint
+			triggerPaths = append(triggerPaths, path)
 		}
-		if filterList[i].Type == "change" {
-			return evaluateChangeFilter(filterList[i].Value, getDPValue(latestDataPoint), getDPValue(currentDataPoint))
+	}
+	return triggerPaths
+}
+
+/**
+* passRangeChangeGate returns true if the range and change filters of the subscription are satisfied by the current value of any of its paths.
+**/
+func passRangeChangeGate(subscriptionState *SubscriptionState, dataPoints map[string]string) bool {
+	if !hasRangeChangeFilter(subscriptionState.filterList) {
+		return true
+	}
+	return len(evaluateRangeChange(subscriptionState, "", dataPoints)) > 0
+}
+
+/**
+* getSampledDataPoint returns the data point of the path from the dataPoints cache, where it is added if it is not yet sampled.
+**/
+func getSampledDataPoint(path string, dataPoints map[string]string) string {
+	dataPoint, ok := dataPoints[path]
+	if !ok {
+		dataPoint = getVehicleData(path)
+		dataPoints[path] = dataPoint
+	}
+	return dataPoint
+}
+
+func getSampledDataPack(pathArray []string, dataPoints map[string]string) string {
+	var dataPack []string
+	for _, path := range pathArray {
+		dataPack = append(dataPack, `{"path":"`+path+`", "dp":`+getSampledDataPoint(path, dataPoints)+"}")
+	}
+	if len(pathArray) > 1 {
+		return "[" + strings.Join(dataPack, ", ") + "]"
+	}
+	return strings.Join(dataPack, ", ")
+}
+
+func getLatestDataPoints(paths []string) []string {
+	dataPoints := make([]string, len(paths))
+	for i, path := range paths {
+		dataPoints[i] = getVehicleData(path)
+	}
+	return dataPoints
+}
+
+func isPathInList(path string, paths []string) bool {
+	for _, listPath := range paths {
+		if listPath == path {
+			return true
 		}
 	}
 	return false
@@ -268,43 +366,15 @@ func unpackDataPoint(dp string) (string, string) { // {"value":"Y", "ts":"Z"}
 	return dataPoint.Value, dataPoint.Ts
 }
 
-func evaluateRangeFilter(opValue string, currentValue string) bool {
-	//utils.Info.Printf("evaluateRangeFilter: opValue=%s", opValue)
-	type ChangeFilter struct {
-		LogicOp  string `json:"logic-op"`
-		Boundary string `json:"boundary"`
-	}
-	var changeFilter []ChangeFilter
-	var err error
-	if strings.Contains(opValue, "[") == false {
-		changeFilter = make([]ChangeFilter, 1)
-		err = json.Unmarshal([]byte(opValue), &(changeFilter[0]))
-	} else {
-		err = json.Unmarshal([]byte(opValue), &changeFilter)
-	}
-	if err != nil {
-		utils.Error.Printf("evaluateRangeFilter: Unmarshal error=%s", err)
-		return false
-	}
+func evaluateRangeFilter(rangeList []utils.RangeFilter, currentValue string) bool {
 	evaluation := true
-	for i := 0; i < len(changeFilter); i++ {
-		evaluation = evaluation && compareValues(changeFilter[i].LogicOp, changeFilter[i].Boundary, currentValue, "0") // currVal - 0 logic-op boundary
+	for i := 0; i < len(rangeList); i++ {
+		evaluation = evaluation && compareValues(rangeList[i].LogicOp, rangeList[i].Boundary, currentValue, "0") // currVal - 0 logic-op boundary
 	}
 	return evaluation
 }
 
-func evaluateChangeFilter(opValue string, latestValue string, currentValue string) bool {
-	//utils.Info.Printf("evaluateChangeFilter: opValue=%s", opValue)
-	type ChangeFilter struct {
-		LogicOp string `json:"logic-op"`
-		Diff    string `json:"diff"`
-	}
-	var changeFilter ChangeFilter
-	err := json.Unmarshal([]byte(opValue), &changeFilter)
-	if err != nil {
-		utils.Error.Printf("evaluateChangeFilter: Unmarshal error=%s", err)
-		return false
-	}
+func evaluateChangeFilter(changeFilter *utils.ChangeFilter, latestValue string, currentValue string) bool {
 	return compareValues(changeFilter.LogicOp, latestValue, currentValue, changeFilter.Diff)
 }
 
@@ -395,49 +465,131 @@ func addDataPackage(incompleteMessage string, dataPack string) string {
 	return incompleteMessage[:len(incompleteMessage)-1] + ", \"data\":" + dataPack + "}"
 }
 
-func checkSubscription(subscriptionChannel chan int, CLChan chan CLPack, backendChannel chan string, subscriptionList []SubscriptionState) []SubscriptionState {
-	var subscriptionMap = make(map[string]interface{})
-	subscriptionMap["action"] = "subscription"
-	select {
-	case subscriptionId := <-subscriptionChannel: // interval notification triggered
-		subscriptionState := subscriptionList[getSubcriptionStateIndex(subscriptionId, subscriptionList)]
-		subscriptionMap["subscriptionId"] = strconv.Itoa(subscriptionState.subscriptionId)
-		subscriptionMap["RouterId"] = subscriptionState.routerId
-		backendChannel <- addDataPackage(utils.FinalizeMessage(subscriptionMap), getDataPack(subscriptionState.path, nil))
-		case clPack := <-CLChan: // curve logging notification
-		index := getSubcriptionStateIndex(clPack.SubscriptionId, subscriptionList)
-		//subscriptionState := subscriptionList[index]
-		subscriptionList[index].SubscriptionThreads--
-		if (clPack.SubscriptionId == closeClSubId && subscriptionList[index].SubscriptionThreads == 0) {
-			subscriptionList = removeFromsubscriptionList(subscriptionList, index)
-			closeClSubId = -1
-		}
-		subscriptionMap["subscriptionId"] = strconv.Itoa(subscriptionList[index].subscriptionId)
-		subscriptionMap["RouterId"] = subscriptionList[index].routerId
-		backendChannel <- addDataPackage(utils.FinalizeMessage(subscriptionMap), clPack.DataPack)
-	default:
-		// check if range or change notification triggered
-		for i := range subscriptionList {
-			triggerDataPoint := getVehicleData(subscriptionList[i].path[0])
-			doTrigger := checkRangeChangeFilter(subscriptionList[i].filterList, subscriptionList[i].latestDataPoint, triggerDataPoint)
-			if doTrigger == true {
-				subscriptionState := subscriptionList[i]
-				subscriptionMap["subscriptionId"] = strconv.Itoa(subscriptionState.subscriptionId)
-				subscriptionMap["RouterId"] = subscriptionState.routerId
-				subscriptionList[i].latestDataPoint = triggerDataPoint
-				backendChannel <- addDataPackage(utils.FinalizeMessage(subscriptionMap), getDataPack(subscriptionList[i].path, nil))
-			}
+/**
+* sendSubscriptionNotification sends the notification to every subscriber of the sampling.
+**/
+func sendSubscriptionNotification(backendChannel chan string, subscriptionState *SubscriptionState, dataPack string) {
+	for _, subscriber := range subscriptionState.subscribers {
+		subscriptionMap := map[string]interface{}{"action": "subscription"}
+		subscriptionMap["subscriptionId"] = strconv.Itoa(subscriber.subscriptionId)
+		subscriptionMap["RouterId"] = subscriber.routerId
+		sendNotification(backendChannel, addDataPackage(utils.FinalizeMessage(subscriptionMap), dataPack))
+	}
+}
+
+/**
+* sendIntervalNotifications notifies the subscriptions that are due together, sampling each signal once for all of them.
+**/
+func sendIntervalNotifications(backendChannel chan string, subscriptionIds []int, subscriptionList []SubscriptionState) {
+	dataPoints := map[string]string{}
+	subscriptionIndex := make(map[int]int, len(subscriptionList))
+	for i := range subscriptionList {
+		subscriptionIndex[subscriptionList[i].subscriptionId] = i
+	}
+	for _, subscriptionId := range subscriptionIds {
+		index, ok := subscriptionIndex[subscriptionId]
+		if !ok { // unsubscribed after the interval expired
+			continue
 		}
+		if !passRangeChangeGate(&subscriptionList[index], dataPoints) {
+			continue
+		}
+		sendSubscriptionNotification(backendChannel, &subscriptionList[index], getSampledDataPack(subscriptionList[index].path, dataPoints))
+	}
+}
+
+func sendCurveLogNotification(backendChannel chan string, clPack CLPack, subscriptionList []SubscriptionState) []SubscriptionState {
+	index := getSubcriptionStateIndex(clPack.SubscriptionId, subscriptionList)
+	if index == -1 {
+		return subscriptionList
+	}
+	//subscriptionState := subscriptionList[index]
+	subscriptionList[index].SubscriptionThreads--
+	if (clPack.SubscriptionId == closeClSubId && subscriptionList[index].SubscriptionThreads == 0) {
+		subscriptionList = removeFromsubscriptionList(subscriptionList, index) // all subscribers have unsubscribed
+		closeClSubId = -1
+		return subscriptionList
+	}
+	if !passRangeChangeGate(&subscriptionList[index], map[string]string{}) {
+		return subscriptionList
 	}
+	sendSubscriptionNotification(backendChannel, &subscriptionList[index], clPack.DataPack)
 	return subscriptionList
 }
 
+/**
+* checkRangeChangeSubscriptions evaluates the range and change filters of the value triggered subscriptions including changedPath,
+* or of all value triggered subscriptions if changedPath is empty, i. e. when the backend signals are polled.
+* The filters are evaluated per path, and the notification contains the triggering paths, or all paths of the subscription,
+* as set by serviceMgr.notifyPaths of the configuration. Each signal is read once, however many subscriptions include it.
+**/
+func checkRangeChangeSubscriptions(backendChannel chan string, changedPath string, subscriptionList []SubscriptionState) {
+	dataPoints := map[string]string{}
+	for i := range subscriptionList {
+		if len(changedPath) > 0 && !isPathInList(changedPath, subscriptionList[i].path) {
+			continue
+		}
+		if !isValueTriggered(subscriptionList[i].filterList) {
+			continue
+		}
+		triggerPaths := evaluateRangeChange(&subscriptionList[i], changedPath, dataPoints)
+		if len(triggerPaths) > 0 {
+			if utils.Config.ServiceMgr.NotifyPaths == utils.NOTIFY_ALL_PATHS {
+				triggerPaths = subscriptionList[i].path
+			}
+			sendSubscriptionNotification(backendChannel, &subscriptionList[i], getSampledDataPack(triggerPaths, dataPoints))
+		}
+	}
+}
+
+/**
+* getSamplingKey returns the key of identical path and filter combinations, which share one sampling.
+**/
+func getSamplingKey(requestMap map[string]interface{}) string {
+	filter, _ := json.Marshal(requestMap["filter"]) // the members of objects are sorted
+	return requestMap["path"].(string) + " " + string(filter)
+}
+
+/**
+* getSamplingIndex returns the index of the sampling having the key, or -1. A curve logging sampling that is closing has no subscribers, and is not shared.
+**/
+func getSamplingIndex(samplingKey string, subscriptionList []SubscriptionState) int {
+	for i := 0; i < len(subscriptionList); i++ {
+		if subscriptionList[i].samplingKey == samplingKey && len(subscriptionList[i].subscribers) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+/**
+* getSubscriberIndex returns the index of the sampling and of the subscriber having the subscription id, or -1, -1.
+**/
+func getSubscriberIndex(subscriptionId int, subscriptionList []SubscriptionState) (int, int) {
+	for i := 0; i < len(subscriptionList); i++ {
+		for j, subscriber := range subscriptionList[i].subscribers {
+			if subscriber.subscriptionId == subscriptionId {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+/**
+* deactivateSubscription removes the subscriber, and stops the sampling when its last subscriber is removed.
+**/
 func deactivateSubscription(subscriptionList []SubscriptionState, subscriptionId string) (int, []SubscriptionState) {
 	id, _ := strconv.Atoi(subscriptionId)
-	index := getSubcriptionStateIndex(id, subscriptionList)
+	index, subscriberIndex := getSubscriberIndex(id, subscriptionList)
 	if index == -1 {
 		return -1, subscriptionList
 	}
+	subscribers := subscriptionList[index].subscribers
+	subscriptionList[index].subscribers = append(subscribers[:subscriberIndex:subscriberIndex], subscribers[subscriberIndex+1:]...)
+	if len(subscriptionList[index].subscribers) > 0 {
+		return 1, subscriptionList
+	}
 	if getOpType(subscriptionList[index].filterList, "timebased") == true {
 		deactivateInterval(subscriptionList[index].subscriptionId)
 	} else if getOpType(subscriptionList[index].filterList, "curvelog") == true {
@@ -467,104 +619,79 @@ func getOpType(filterList []utils.FilterObject, opType string) bool {
 	return false
 }
 
-func getIntervalPeriod(opValue string) int { // {"period":"X"}
-	type IntervalData struct {
-		Period string `json:"period"`
-	}
-	var intervalData IntervalData
-	err := json.Unmarshal([]byte(opValue), &intervalData)
-	if err != nil {
-		utils.Error.Printf("getIntervalPeriod: Unmarshal failed, err=%s", err)
-		return -1
-	}
-	period, err := strconv.Atoi(intervalData.Period)
-	if err != nil {
-		utils.Error.Printf("getIntervalPeriod: Invalid period=%s", period)
-		return -1
-	}
-	return period
-}
-
-func getCurveLoggingParams(opValue string) (float64, int) { // {"maxerr": "X", "bufsize":"Y"}
-	type CLData struct {
-		MaxErr  string `json:"maxerr"`
-		BufSize string `json:"bufsize"`
-	}
-	var cLData CLData
-	err := json.Unmarshal([]byte(opValue), &cLData)
-	if err != nil {
-		utils.Error.Printf("getIntervalPeriod: Unmarshal failed, err=%s", err)
-		return 0.0, 0
-	}
-	maxErr, err := strconv.ParseFloat(cLData.MaxErr, 64)
-	if err != nil {
-		utils.Error.Printf("getIntervalPeriod: MaxErr invalid integer, maxErr=%s", cLData.MaxErr)
-		maxErr = 0.0
-	}
-	bufSize, err := strconv.Atoi(cLData.BufSize)
-	if err != nil {
-		utils.Error.Printf("getIntervalPeriod: BufSize invalid integer, BufSize=%s", cLData.BufSize)
-		maxErr = 0.0
-	}
-	return maxErr, bufSize
-}
-
-func activateIfIntervalOrCL(filterList []utils.FilterObject, subscriptionChan chan int, CLChan chan CLPack, subscriptionId int, paths []string) {
+func activateIfIntervalOrCL(filterList []utils.FilterObject, CLChan chan CLPack, subscriptionId int, paths []string) {
 	for i := 0; i < len(filterList); i++ {
-		if filterList[i].Type == "timebased" {
-			interval := getIntervalPeriod(filterList[i].Value)
+		if filterList[i].Type == utils.FILTER_TIMEBASED {
+			interval := filterList[i].Timebased.Period
 			utils.Info.Printf("interval activated, period=%d", interval)
-			if interval > 0 {
-				activateInterval(subscriptionChan, subscriptionId, interval)
-			}
+			activateInterval(subscriptionId, interval)
 			break
 		}
-		if filterList[i].Type == "curvelog" {
-			go curveLoggingServer(CLChan, threadsChan, subscriptionId, filterList[i].Value, paths)
+		if filterList[i].Type == utils.FILTER_CURVELOG {
+			go curveLoggingServer(CLChan, threadsChan, subscriptionId, filterList[i].Curvelog, paths)
 			break
 		}
 	}
 }
 
 func getVehicleData(path string) string { // returns {"value":"Y", "ts":"Z"}
-	if isStateStorage == true {
-		rows, err := db.Query("SELECT `value`, `timestamp` FROM VSS_MAP WHERE `path`=?", path)
-		if err != nil {
-			return `{"value":"` + strconv.Itoa(dummyValue) + `", "ts":"` + utils.GetRfcTime() + `"}`
-		}
-		defer rows.Close()
-		value := ""
-		timestamp := ""
+	dataPoint, _ := readVehicleData(path)
+	return dataPoint
+}
 
-		rows.Next()
-		err = rows.Scan(&value, &timestamp)
-		if err != nil {
-			return `{"value":"` + strconv.Itoa(dummyValue) + `", "ts":"` + utils.GetRfcTime() + `"}`
+func readVehicleData(path string) (string, bool) { // returns {"value":"Y", "ts":"Z"}, and true if it is a dummy value
+	if backend != nil {
+		value, timestamp, err := backend.Get(path)
+		if err == nil {
+			recordDataPointTs(path, timestamp)
+			return `{"value":"` + value + `", "ts":"` + timestamp + `"}`, false
+		}
+		if err != errNoValue {
+			utils.Error.Printf("Could not read %s from the vehicle data backend, err = %s", path, err)
 		}
-		return `{"value":"` + value + `", "ts":"` + timestamp + `"}`
-	} else {
-		return `{"value":"` + strconv.Itoa(dummyValue) + `", "ts":"` + utils.GetRfcTime() + `"}`
 	}
+	return `{"value":"` + strconv.Itoa(dummyValue) + `", "ts":"` + utils.GetRfcTime() + `"}`, true
 }
 
-func setVehicleData(path string, value string) string {
-	if isStateStorage == true {
-		stmt, err := db.Prepare("UPDATE VSS_MAP SET value=?, timestamp=? WHERE `path`=?")
-		if err != nil {
-			utils.Error.Printf("Could not prepare for statestorage updating, err = %s", err)
-			return ""
-		}
-		defer stmt.Close()
+/**
+* setVehicleData updates the paths in the vehicle data backend, so that either all or none of them are updated.
+* The timestamp of the update is returned, or an empty string on failure.
+**/
+func setVehicleData(paths []string, values []string) string {
+	if backend == nil {
+		return ""
+	}
+	ts, err := backend.Set(paths, values)
+	if err != nil {
+		utils.Error.Printf("setVehicleData():%s", err)
+		return ""
+	}
+	return ts
+}
 
-		ts := utils.GetRfcTime()
-		_, err = stmt.Exec(value, ts, path[1:len(path)-1]) // remove quotes surrounding path
-		if err != nil {
-			utils.Error.Printf("Could not update statestorage, err = %s", err)
-			return ""
+/**
+* unpackSetValues returns the values of a set request, one string value per path.
+**/
+func unpackSetValues(value interface{}, numOfPaths int) []string {
+	switch vv := value.(type) {
+	case string:
+		if numOfPaths == 1 {
+			return []string{vv}
+		}
+	case []interface{}:
+		if len(vv) != numOfPaths {
+			return nil
 		}
-		return ts
+		values := make([]string, len(vv))
+		for i, element := range vv {
+			var ok bool
+			if values[i], ok = element.(string); !ok {
+				return nil
+			}
+		}
+		return values
 	}
-	return ""
+	return nil
 }
 
 func unpackPaths(paths string) []string {
@@ -581,6 +708,10 @@ func unpackPaths(paths string) []string {
 	return pathArray
 }
 
+/**
+* createHistoryList adds the paths in the path list file that are not already in the history list.
+* When the server core has reloaded the VSS tree, removed paths are kept, as the history tickers refer to the list index.
+**/
 func createHistoryList(fname string) bool {
 	type PathList struct {
 		LeafPaths []string
@@ -598,42 +729,110 @@ func createHistoryList(fname string) bool {
 		utils.Error.Printf("Error unmarshal json=%s, err=%s\n", data, err)
 		return false
 	}
-	historyList = make([]HistoryList, len(pathList.LeafPaths))
 	for i := 0; i < len(pathList.LeafPaths); i++ {
-		historyList[i].Path = pathList.LeafPaths[i]
-		historyList[i].Frequency = 0
-		historyList[i].BufSize = 0
-		historyList[i].Status = 0
-		historyList[i].BufIndex = 0
-		historyList[i].Buffer = nil
+		if getHistoryListIndex(pathList.LeafPaths[i]) != -1 {
+			continue
+		}
+		var historyElement HistoryList
+		historyElement.Path = pathList.LeafPaths[i]
+		historyElement.Frequency = 0
+		historyElement.BufSize = 0
+		historyElement.Status = 0
+		historyList = append(historyList, historyElement)
 	}
 	return true
 }
 
+/**
+* loadHistoryList restores the signals created in the history store before a restart, and resumes the recording of those that were started.
+* Signals that are not in the path list are added to the history list, as they are kept at a reload of the VSS tree.
+**/
+func loadHistoryList() {
+	signals, err := historyStore.loadSignals()
+	if err != nil {
+		utils.Error.Printf("loadHistoryList:Could not read the history store, err = %s", err)
+		return
+	}
+	for _, signal := range signals {
+		index := getHistoryListIndex(signal.Path)
+		if index == -1 {
+			historyList = append(historyList, HistoryList{Path: signal.Path})
+			index = len(historyList) - 1
+		}
+		historyList[index] = signal
+		updateHistoryMetrics(index)
+		if signal.Status == 1 && isValidHistoryFrequency(signal.Frequency) {
+			activateHistory(index, signal.Frequency)
+		}
+		utils.Info.Printf("loadHistoryList:%s restored with %d data points", signal.Path, signal.BufCount)
+	}
+}
+
+func retainHistory() {
+	for i := 0; i < len(historyList); i++ {
+		if historyList[i].BufSize == 0 || historyList[i].MaxAge == 0 {
+			continue
+		}
+		count, err := historyStore.retain(historyList[i])
+		if err != nil {
+			utils.Error.Printf("retainHistory:Could not apply the retention of %s, err = %s", historyList[i].Path, err)
+			continue
+		}
+		historyList[i].BufCount = count
+		updateHistoryMetrics(i)
+	}
+}
+
 func historyServer(historyAccessChan chan string, udsPath string, vssPathList string) {
 	listExists := createHistoryList(vssPathList) // file is created by core-server at startup
+	pathListModTime := utils.FileModTime(vssPathList)
+	pathListTicker := time.NewTicker(5 * time.Second)
 	histCtrlChannel := make(chan string)
+	retentionTicker := time.NewTicker(historyRetentionInterval)
 	go initHistoryControlServer(histCtrlChannel, udsPath)
-	historyChannel := make(chan int)
+	historyScheduler = NewScheduler()
+	if listExists == true {
+		loadHistoryList()
+	}
 	for {
 		select {
-		case signalId := <-historyChannel:
-			captureHistoryValue(signalId)
+		case signalIds := <-historyScheduler.C:
+			for _, signalId := range signalIds {
+				captureHistoryValue(signalId)
+			}
 		case histCtrlReq := <-histCtrlChannel: // history config request
-			histCtrlChannel <- processHistoryCtrl(histCtrlReq, historyChannel, listExists)
+			histCtrlChannel <- processHistoryCtrl(histCtrlReq, listExists)
 		case getRequest := <-historyAccessChan: // history get request
 			response := ""
 			if listExists == true {
 				response = processHistoryGet(getRequest)
 			}
 			historyAccessChan <- response
+		case path := <-historyStatusChannel: // dynamic metadata request
+			status := "inactive"
+			if listExists == true {
+				index := getHistoryListIndex(path)
+				if index != -1 && historyList[index].Status == 1 {
+					status = "active"
+				}
+			}
+			historyStatusChannel <- status
+		case <-pathListTicker.C: // the file is regenerated by core-server when the VSS tree is reloaded
+			modTime := utils.FileModTime(vssPathList)
+			if modTime.After(pathListModTime) {
+				pathListModTime = modTime
+				listExists = createHistoryList(vssPathList) || listExists
+				utils.Info.Printf("historyServer():path list reloaded, %d paths", len(historyList))
+			}
+		case <-retentionTicker.C:
+			retainHistory()
 		default:
 			time.Sleep(50 * time.Millisecond)
 		}
 	}
 }
 
-func processHistoryCtrl(histCtrlReq string, historyChan chan int, listExists bool) string {
+func processHistoryCtrl(histCtrlReq string, listExists bool) string {
 	if listExists == false {
 		utils.Error.Printf("processHistoryCtrl:Path list not found")
 		return "500 Internal Server Error"
@@ -645,6 +844,10 @@ func processHistoryCtrl(histCtrlReq string, historyChan chan int, listExists boo
 		return "400 Bad Request"
 	}
 	index := getHistoryListIndex(requestMap["path"].(string))
+	if index == -1 {
+		utils.Error.Printf("processHistoryCtrl:Path not found=%s", requestMap["path"].(string))
+		return "404 Not Found"
+	}
 	switch requestMap["action"].(string) {
 	case "create":
 		if requestMap["buf-size"] == nil {
@@ -656,33 +859,70 @@ func processHistoryCtrl(histCtrlReq string, historyChan chan int, listExists boo
 			utils.Error.Printf("processHistoryCtrl:Buffer size malformed=%s", requestMap["buf-size"].(string))
 			return "400 Bad Request"
 		}
+		if bufSize <= 0 || bufSize > historyMaxBufSize {
+			bufSize = historyMaxBufSize
+		}
+		maxAge := 0
+		if requestMap["max-age"] != nil && len(requestMap["max-age"].(string)) > 0 {
+			maxAge, err = strconv.Atoi(requestMap["max-age"].(string))
+			if err != nil || maxAge < 0 {
+				utils.Error.Printf("processHistoryCtrl:Max age malformed=%s", requestMap["max-age"].(string))
+				return "400 Bad Request"
+			}
+		}
 		historyList[index].BufSize = bufSize
-		historyList[index].Buffer = make([]string, bufSize)
+		historyList[index].MaxAge = maxAge
+		if saveHistorySignal(index) == false {
+			return "500 Internal Server Error"
+		}
+		count, err := historyStore.retain(historyList[index]) // the buffer of a created signal may have been reduced
+		if err != nil {
+			utils.Error.Printf("processHistoryCtrl:Could not apply the retention, err = %s", err)
+			return "500 Internal Server Error"
+		}
+		historyList[index].BufCount = count
+		updateHistoryMetrics(index)
 	case "start":
 		if requestMap["frequency"] == nil {
 			utils.Error.Printf("processHistoryCtrl:Frequency missing")
 			return "400 Bad Request"
 		}
 		freq, err := strconv.Atoi(requestMap["frequency"].(string))
-		if err != nil {
+		if err != nil || isValidHistoryFrequency(freq) == false {
 			utils.Error.Printf("processHistoryCtrl:Frequeny malformed=%s", requestMap["frequency"].(string))
 			return "400 Bad Request"
 		}
+		if historyList[index].BufSize == 0 {
+			utils.Error.Printf("processHistoryCtrl:History buffer must first be created")
+			return "409 Conflict"
+		}
 		historyList[index].Frequency = freq
 		historyList[index].Status = 1
-		activateHistory(historyChan, index, freq)
+		if saveHistorySignal(index) == false {
+			return "500 Internal Server Error"
+		}
+		activateHistory(index, freq)
 	case "stop":
 		historyList[index].Status = 0
 		deactivateHistory(index)
+		if historyList[index].BufSize != 0 && saveHistorySignal(index) == false {
+			return "500 Internal Server Error"
+		}
 	case "delete":
 		if historyList[index].Status != 0 {
 			utils.Error.Printf("processHistoryCtrl:History recording must first be stopped")
 			return "409 Conflict"
 		}
+		if err := historyStore.deleteSignal(historyList[index].Path); err != nil {
+			utils.Error.Printf("processHistoryCtrl:Could not delete from the history store, err = %s", err)
+			return "500 Internal Server Error"
+		}
 		historyList[index].Frequency = 0
 		historyList[index].BufSize = 0
-		historyList[index].BufIndex = 0
-		historyList[index].Buffer = nil
+		historyList[index].MaxAge = 0
+		historyList[index].BufCount = 0
+		historyList[index].LatestTs = ""
+		updateHistoryMetrics(index)
 	default:
 		utils.Error.Printf("processHistoryCtrl:Unknown command:action=%s", requestMap["action"].(string))
 		return "400 Bad Request"
@@ -690,6 +930,14 @@ func processHistoryCtrl(histCtrlReq string, historyChan chan int, listExists boo
 	return "200 OK"
 }
 
+func saveHistorySignal(signalId int) bool {
+	if err := historyStore.saveSignal(historyList[signalId]); err != nil {
+		utils.Error.Printf("saveHistorySignal:Could not save %s in the history store, err = %s", historyList[signalId].Path, err)
+		return false
+	}
+	return true
+}
+
 func getHistoryListIndex(path string) int {
 	for i := 0; i < len(historyList); i++ {
 		if historyList[i].Path == path {
@@ -711,33 +959,30 @@ func convertFromIsoTime(isoTime string) (time.Time, error) {
 func processHistoryGet(request string) string { // {"path":"X", "period":"Y"}
 	var requestMap = make(map[string]interface{})
 	utils.MapRequest(request, &requestMap)
-	index := getHistoryListIndex(requestMap["path"].(string))
 	currentTs := getCurrentUtcTime()
 	periodTime, _ := convertFromIsoTime(requestMap["period"].(string))
 	oldTs := currentTs.Add(time.Hour*(time.Duration)((24*periodTime.Day()+periodTime.Hour())*(-1)) -
 		time.Minute*(time.Duration)(periodTime.Minute()) - time.Second*(time.Duration)(periodTime.Second())).UTC()
-	var matches int
-	for matches = 0; matches < historyList[index].BufIndex; matches++ {
-		storedTs, _ := convertFromIsoTime(getDPTs(historyList[index].Buffer[matches]))
-		if storedTs.Before(oldTs) {
-			break
-		}
+	dataPoints, err := historyStore.read(requestMap["path"].(string), oldTs)
+	if err != nil {
+		utils.Error.Printf("processHistoryGet:Could not read the history store, err = %s", err)
+		return ""
 	}
-	return historicDataPack(index, matches)
+	return historicDataPack(dataPoints)
 }
 
-func historicDataPack(index int, matches int) string {
+func historicDataPack(dataPoints []string) string {
 	dp := ""
-	if matches > 1 {
+	if len(dataPoints) > 1 {
 		dp += "["
 	}
-	for i := 0; i < matches; i++ {
-		dp += `{"value":"` + getDPValue(historyList[index].Buffer[i]) + `", "ts":"` + getDPTs(historyList[index].Buffer[i]) + `"}, `
+	for i := 0; i < len(dataPoints); i++ {
+		dp += dataPoints[i] + ", "
 	}
-	if matches > 0 {
+	if len(dataPoints) > 0 {
 		dp = dp[:len(dp)-2]
 	}
-	if matches > 1 {
+	if len(dataPoints) > 1 {
 		dp += "]"
 	}
 	return dp
@@ -747,15 +992,18 @@ func captureHistoryValue(signalId int) {
 	dp := getVehicleData(historyList[signalId].Path)
 	utils.Info.Printf("captureHistoryValue:Captured historic dp = %s", dp)
 	newTs := getDPTs(dp)
-	latestTs := ""
-	if historyList[signalId].BufIndex > 0 {
-		latestTs = getDPTs(historyList[signalId].Buffer[historyList[signalId].BufIndex-1])
+	if newTs == historyList[signalId].LatestTs || historyList[signalId].BufSize == 0 {
+		return
 	}
-	if newTs != latestTs && historyList[signalId].BufIndex < historyList[signalId].BufSize-1 {
-		historyList[signalId].Buffer[historyList[signalId].BufIndex] = dp
-		utils.Info.Printf("captureHistoryValue:Saved historic dp in buffer element=%d", historyList[signalId].BufIndex)
-		historyList[signalId].BufIndex++
+	count, err := historyStore.append(historyList[signalId], getDPValue(dp), newTs) // the oldest data point is overwritten when the buffer is full
+	if err != nil {
+		utils.Error.Printf("captureHistoryValue:Could not save historic dp, err = %s", err)
+		return
 	}
+	utils.Info.Printf("captureHistoryValue:Saved historic dp, %d data points in buffer", count)
+	historyList[signalId].LatestTs = newTs
+	historyList[signalId].BufCount = count
+	updateHistoryMetrics(signalId)
 }
 
 func initHistoryControlServer(histCtrlChan chan string, udsPath string) {
@@ -808,8 +1056,8 @@ func getDataPack(pathArray []string, filterList []utils.FilterObject) string {
 	period := ""
 	if filterList != nil {
 		for i := 0; i < len(filterList); i++ {
-			if filterList[i].Type == "history" {
-				period = filterList[i].Value
+			if filterList[i].Type == utils.FILTER_HISTORY {
+				period = filterList[i].History.Period
 				utils.Info.Printf("Historic data request, period=%s", period)
 				getHistory = true
 				break
@@ -850,15 +1098,20 @@ func main() {
 	udsPath := parser.String("", "uds", &argparse.Options{
 		Required: false,
 		Help:     "Set UDS path and file",
-		Default:  "/tmp/vissv2/histctrlserver.sock"})
+		Default:  DEFAULT_UDS_PATH})
 	vssPathList := parser.String("", "vssPathList", &argparse.Options{
 		Required: false,
-		Help:     "Set the path to vsspathlist file",
-		Default:  "../vsspathlist.json"})
+		Help:     "Set the path to vsspathlist file, replaces paths.vssPathList of the configuration"})
 	dbFile := parser.String("", "dbfile", &argparse.Options{
 		Required: false,
-		Help:     "statestorage database filename",
-		Default:  "statestorage.db"})
+		Help:     "statestorage database filename, replaces serviceMgr.dbFile of the configuration"})
+	rootNode := parser.String("", "rootnode", &argparse.Options{
+		Required: false,
+		Help:     "root node of the VSS subtree served by this service manager",
+		Default:  DEFAULT_ROOT_NODE})
+	configFile := parser.String("", "config", &argparse.Options{
+		Required: false,
+		Help:     "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -870,23 +1123,45 @@ func main() {
 	//listExists := createHistoryList("../vsspathlist.json") // file is created by core-server at startup
 
 	utils.InitLog("service-mgr-log.txt", "./logs", *logFile, *logLevel)
-	if utils.FileExists(*dbFile) {
-		db, dbErr = sql.Open("sqlite3", *dbFile)
-		if dbErr != nil {
-			utils.Error.Printf("Could not open DB file = %s, err = %s", *dbFile, dbErr)
-			os.Exit(1)
-		}
-		defer db.Close()
-		isStateStorage = true
+	utils.InitConfig(*configFile)
+	if len(*vssPathList) == 0 {
+		*vssPathList = utils.Config.Paths.VssPathList
 	}
+	if len(*dbFile) > 0 {
+		utils.Config.ServiceMgr.DbFile = *dbFile
+	} else {
+		utils.Config.ServiceMgr.DbFile = getInstanceFileName(utils.Config.ServiceMgr.DbFile, *rootNode)
+	}
+	utils.Config.ServiceMgr.HistoryDbFile = getInstanceFileName(utils.Config.ServiceMgr.HistoryDbFile, *rootNode)
+	if *udsPath == DEFAULT_UDS_PATH {
+		*udsPath = getInstanceFileName(*udsPath, *rootNode)
+	}
+	backend, err = newBackend(utils.Config.ServiceMgr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		utils.Error.Printf("%s", err)
+		os.Exit(1)
+	}
+	if backend != nil {
+		defer backend.Close()
+		utils.Info.Printf("Vehicle data backend %s", utils.Config.ServiceMgr.Backend)
+	}
+	historyStore, err = openHistoryStore(utils.Config.ServiceMgr.HistoryDbFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		utils.Error.Printf("%s", err)
+		os.Exit(1)
+	}
+	defer historyStore.Close()
 
 	hostIp = utils.GetModelIP(2)
 	var regResponse RegResponse
 	dataChan := make(chan string)
-	backendChan := make(chan string)
-	regRequest := RegRequest{Rootnode: "Vehicle"}
-	subscriptionChan := make(chan int)
+	backendChan := make(chan string, BACKEND_CHAN_SIZE)
+	regRequest := RegRequest{Rootnode: *rootNode}
+	subscriptionScheduler = NewScheduler()
 	historyAccessChannel = make(chan string)
+	historyStatusChannel = make(chan string)
 	CLChannel = make(chan CLPack, 5) // allow some buffering...
 	subscriptionList := []SubscriptionState{}
 	subscriptionId = 1 // do not start with zero!
@@ -896,7 +1171,14 @@ func main() {
 	}
 	go initDataServer(utils.MuxServer[1], dataChan, backendChan, regResponse)
 	go historyServer(historyAccessChannel, *udsPath, *vssPathList)
+	go utils.ServeMetrics(getMetricsPort(regResponse))
 	dummyTicker := time.NewTicker(47 * time.Millisecond)
+	changeChan := make(chan string, CHANGE_CHAN_SIZE)
+	var pollChan <-chan time.Time // nil if the backend notifies changes
+	if backend == nil || backend.Subscribe(changeChan) != nil {
+		pollChan = time.NewTicker(50 * time.Millisecond).C
+		utils.Info.Printf("Range and change subscriptions are polled")
+	}
 	utils.Info.Printf("initDataServer() done\n")
 	for {
 		select {
@@ -910,15 +1192,17 @@ func main() {
 			responseMap["action"] = requestMap["action"]
 			responseMap["requestId"] = requestMap["requestId"]
 			switch requestMap["action"] {
-			case "set":
-				if strings.Contains(requestMap["path"].(string), "[") == true {
-					utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Forbidden request", "Set request must only address a single end point.")
+			case "set": // one or more actuators, set in one transaction
+				pathArray := unpackPaths(requestMap["path"].(string))
+				valueArray := unpackSetValues(requestMap["value"], len(pathArray))
+				if pathArray == nil || valueArray == nil {
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Set request must have one string value per path.")
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
 					break
 				}
-				ts := setVehicleData(requestMap["path"].(string), requestMap["value"].(string))
+				ts := setVehicleData(pathArray, valueArray)
 				if len(ts) == 0 {
-					utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Internal error", "Underlying system failed to update.")
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadGateway, "Underlying system failed to update.")
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
 					break
 				}
@@ -928,27 +1212,36 @@ func main() {
 				pathArray := unpackPaths(requestMap["path"].(string))
 				if pathArray == nil {
 					utils.Error.Printf("Unmarshal of path array failed.")
-					utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Internal error.", "Unmarshal failed on array of paths.")
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Unmarshal failed on array of paths.")
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
 					break
 				}
 				var filterList []utils.FilterObject
 				if requestMap["filter"] != nil && requestMap["filter"] != "" {
-					//				filterData, err := json.Marshal(requestMap["filter"])
-					//				if err != nil {
-					utils.UnpackFilter(requestMap["filter"], &filterList)
-					if len(filterList) == 0 {
-						utils.Error.Printf("Request filter malformed.")
-						utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Bad request", "Request filter malformed.")
+					var err error
+					filterList, err = utils.UnpackFilter(requestMap["filter"])
+					if err != nil {
+						utils.Error.Printf("Request filter malformed, err=%s", err)
+						utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, err.Error())
 						dataChan <- utils.FinalizeMessage(errorResponseMap)
 						break
 					}
-					//				filter = string(filterData)
+				}
+				if metadataFilter := utils.GetFilter(filterList, utils.FILTER_DYNAMIC_METADATA); metadataFilter != nil {
+					metadata, err := getDynamicMetadata(pathArray, metadataFilter.DynamicMetadata, subscriptionList)
+					if err != nil {
+						utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, err.Error())
+						dataChan <- utils.FinalizeMessage(errorResponseMap)
+						break
+					}
+					responseMap["ts"] = utils.GetRfcTime()
+					dataChan <- utils.AddKeyValue(utils.FinalizeMessage(responseMap), "metadata", metadata)
+					break
 				}
 				dataPack := getDataPack(pathArray, filterList)
 				if len(dataPack) == 0 {
 					utils.Info.Printf("No historic data available")
-					utils.SetErrorResponse(requestMap, errorResponseMap, "404", "Not found", "Historic data not available.")
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrUnavailableData, "Historic data not available.")
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
 					break
 				}
@@ -956,22 +1249,29 @@ func main() {
 			case "subscribe":
 				var subscriptionState SubscriptionState
 				subscriptionState.subscriptionId = subscriptionId
-				subscriptionState.routerId = requestMap["RouterId"].(string)
+				subscriptionState.subscribers = []Subscriber{{subscriptionId, requestMap["RouterId"].(string)}}
 				subscriptionState.path = unpackPaths(requestMap["path"].(string))
 				if requestMap["filter"] == nil || requestMap["filter"] == "" {
-					utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Filter missing.", "")
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Filter missing.")
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
 					break
 				}
-				utils.UnpackFilter(requestMap["filter"], &(subscriptionState.filterList))
-				if len(subscriptionState.filterList) == 0 {
-					utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Invalid filter.", "See VISSv2 specification.")
+				var err error
+				subscriptionState.filterList, err = utils.UnpackFilter(requestMap["filter"])
+				if err != nil {
+					utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Invalid filter: "+err.Error())
 					dataChan <- utils.FinalizeMessage(errorResponseMap)
+					break
 				}
-				subscriptionState.latestDataPoint = getVehicleData(subscriptionState.path[0])
-				subscriptionList = append(subscriptionList, subscriptionState)
 				responseMap["subscriptionId"] = strconv.Itoa(subscriptionId)
-				activateIfIntervalOrCL(subscriptionState.filterList, subscriptionChan, CLChannel, subscriptionId, subscriptionState.path)
+				subscriptionState.samplingKey = getSamplingKey(requestMap)
+				if index := getSamplingIndex(subscriptionState.samplingKey, subscriptionList); index != -1 { // identical subscription, the sampling is shared
+					subscriptionList[index].subscribers = append(subscriptionList[index].subscribers, subscriptionState.subscribers[0])
+				} else {
+					subscriptionState.latestDataPoints = getLatestDataPoints(subscriptionState.path)
+					subscriptionList = append(subscriptionList, subscriptionState)
+					activateIfIntervalOrCL(subscriptionState.filterList, CLChannel, subscriptionId, subscriptionState.path)
+				}
 				subscriptionId++ // not to be incremented elsewhere
 				dataChan <- utils.FinalizeMessage(responseMap)
 			case "unsubscribe":
@@ -987,12 +1287,13 @@ func main() {
 						}
 					}
 				}
-				utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Unsubscribe failed.", "Incorrect or missing subscription id.")
+				utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrInvalidData, "Incorrect or missing subscription id.")
 				dataChan <- utils.FinalizeMessage(errorResponseMap)
 			default:
-				utils.SetErrorResponse(requestMap, errorResponseMap, "400", "Unknown action.", "")
+				utils.SetErrorResponse(requestMap, errorResponseMap, utils.ErrBadRequest, "Unknown action.")
 				dataChan <- utils.FinalizeMessage(errorResponseMap)
 			} // switch
+			updateSubscriptionMetrics(subscriptionList) // only requests and curve logging closing change the list
 		case <-dummyTicker.C:
 			dummyValue++
 			if dummyValue > 999 {
@@ -1000,9 +1301,15 @@ func main() {
 			}
 		case subThreads := <- threadsChan:
 			subscriptionList = setSubscriptionListThreads(subscriptionList, subThreads)
-		default:
-			subscriptionList = checkSubscription(subscriptionChan, CLChannel, backendChan, subscriptionList)
-			time.Sleep(50 * time.Millisecond)
+		case subscriptionIds := <-subscriptionScheduler.C: // interval notifications triggered
+			sendIntervalNotifications(backendChan, subscriptionIds, subscriptionList)
+		case clPack := <-CLChannel: // curve logging notification
+			subscriptionList = sendCurveLogNotification(backendChan, clPack, subscriptionList)
+			updateSubscriptionMetrics(subscriptionList)
+		case changedPath := <-changeChan: // range or change notification may be triggered
+			checkRangeChangeSubscriptions(backendChan, changedPath, subscriptionList)
+		case <-pollChan:
+			checkRangeChangeSubscriptions(backendChan, "", subscriptionList)
 		} // select
 	} // for
 }
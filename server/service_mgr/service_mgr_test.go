@@ -0,0 +1,226 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+	"github.com/gorilla/websocket"
+)
+
+func TestCombinedFilters(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	defer func() { backend = nil }()
+	backend.Set([]string{"Vehicle.Speed"}, []string{"40"})
+	rangeFilter := map[string]interface{}{"type": "range", "value": map[string]interface{}{"logic-op": "gt", "boundary": "50"}}
+	changeFilter := map[string]interface{}{"type": "change", "value": map[string]interface{}{"logic-op": "ne", "diff": "0"}}
+	timebasedFilter := map[string]interface{}{"type": "timebased", "value": map[string]interface{}{"period": "5"}}
+	changeRange, _ := utils.UnpackFilter([]interface{}{changeFilter, rangeFilter})
+	timebasedRange, _ := utils.UnpackFilter([]interface{}{timebasedFilter, rangeFilter})
+	subscriptionList := []SubscriptionState{
+		{subscriptionId: 1, subscribers: []Subscriber{{1, "1?1"}}, path: []string{"Vehicle.Speed"}, filterList: changeRange, latestDataPoints: getLatestDataPoints([]string{"Vehicle.Speed"})},
+		{subscriptionId: 2, subscribers: []Subscriber{{2, "1?2"}}, path: []string{"Vehicle.Speed"}, filterList: timebasedRange, latestDataPoints: getLatestDataPoints([]string{"Vehicle.Speed"})},
+	}
+	backendChan := make(chan string, 10)
+
+	backend.Set([]string{"Vehicle.Speed"}, []string{"45"}) // changed, but not in range
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList)
+	sendIntervalNotifications(backendChan, []int{2}, subscriptionList)
+	if len(backendChan) != 0 {
+		t.Errorf("notification out of range: %s", <-backendChan)
+	}
+	backend.Set([]string{"Vehicle.Speed"}, []string{"60"})
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList) // not triggering the timebased subscription
+	if len(backendChan) != 1 || !strings.Contains(<-backendChan, `"subscriptionId":"1"`) {
+		t.Errorf("change in range not notified")
+	}
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList)
+	if len(backendChan) != 0 {
+		t.Errorf("unchanged value in range notified: %s", <-backendChan)
+	}
+	sendIntervalNotifications(backendChan, []int{2}, subscriptionList)
+	if len(backendChan) != 1 || !strings.Contains(<-backendChan, `"subscriptionId":"2"`) {
+		t.Errorf("interval in range not notified")
+	}
+}
+
+func TestMultiPathRangeChange(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	defer func() { backend = nil; utils.Config = utils.DefaultConfig() }()
+	paths := []string{"Vehicle.Speed", "Vehicle.Powertrain.CombustionEngine.Engine.Speed"}
+	backend.Set(paths, []string{"40", "2000"})
+	changeFilter, _ := utils.UnpackFilter(map[string]interface{}{"type": "change", "value": map[string]interface{}{"logic-op": "ne", "diff": "0"}})
+	subscriptionList := []SubscriptionState{{subscriptionId: 1, subscribers: []Subscriber{{1, "1?1"}}, path: paths, filterList: changeFilter, latestDataPoints: getLatestDataPoints(paths)}}
+	backendChan := make(chan string, 10)
+
+	backend.Set(paths[1:], []string{"2500"})
+	checkRangeChangeSubscriptions(backendChan, paths[1], subscriptionList)
+	if len(backendChan) != 1 {
+		t.Fatalf("%d notifications of the change of the second path", len(backendChan))
+	}
+	if notification := <-backendChan; !strings.Contains(notification, paths[0]) || !strings.Contains(notification, `"value":"2500"`) {
+		t.Errorf("notification does not contain all paths: %s", notification)
+	}
+	if getDPValue(subscriptionList[0].latestDataPoints[1]) != "2500" || getDPValue(subscriptionList[0].latestDataPoints[0]) != "40" {
+		t.Errorf("unexpected latest data points %v", subscriptionList[0].latestDataPoints)
+	}
+
+	utils.Config.ServiceMgr.NotifyPaths = utils.NOTIFY_TRIGGER_PATHS
+	backend.Set(paths[1:], []string{"3000"})
+	checkRangeChangeSubscriptions(backendChan, "", subscriptionList) // polled
+	if len(backendChan) != 1 {
+		t.Fatalf("%d notifications of the polled change", len(backendChan))
+	}
+	if notification := <-backendChan; strings.Contains(notification, `"`+paths[0]+`"`) || !strings.Contains(notification, `"value":"3000"`) {
+		t.Errorf("notification does not contain only the triggering path: %s", notification)
+	}
+}
+
+func TestSharedSampling(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	backend, _ = newBackend(utils.ServiceMgrConfig{Backend: "memory"})
+	defer func() { backend = nil }()
+	backend.Set([]string{"Vehicle.Speed"}, []string{"40"})
+	filter := map[string]interface{}{"type": "change", "value": map[string]interface{}{"logic-op": "ne", "diff": "0"}}
+	sameFilter := map[string]interface{}{"value": map[string]interface{}{"diff": "0", "logic-op": "ne"}, "type": "change"}
+	samplingKey := getSamplingKey(map[string]interface{}{"path": "Vehicle.Speed", "filter": filter})
+	if getSamplingKey(map[string]interface{}{"path": "Vehicle.Speed", "filter": sameFilter}) != samplingKey {
+		t.Errorf("identical filters have different sampling keys")
+	}
+	if getSamplingKey(map[string]interface{}{"path": "Vehicle.Acceleration.Lateral", "filter": filter}) == samplingKey {
+		t.Errorf("different paths have the same sampling key")
+	}
+	changeFilter, _ := utils.UnpackFilter(filter)
+	subscriptionList := []SubscriptionState{{subscriptionId: 1, subscribers: []Subscriber{{1, "1?1"}, {2, "2?1"}}, samplingKey: samplingKey, path: []string{"Vehicle.Speed"}, filterList: changeFilter, latestDataPoints: getLatestDataPoints([]string{"Vehicle.Speed"})}}
+	if getSamplingIndex(samplingKey, subscriptionList) != 0 {
+		t.Errorf("sampling not found")
+	}
+	if countSubscriptions("Vehicle.Speed", subscriptionList) != 2 {
+		t.Errorf("subscribers not counted")
+	}
+	backendChan := make(chan string, 10)
+
+	backend.Set([]string{"Vehicle.Speed"}, []string{"50"})
+	checkRangeChangeSubscriptions(backendChan, "Vehicle.Speed", subscriptionList)
+	if len(backendChan) != 2 {
+		t.Fatalf("%d notifications to 2 subscribers", len(backendChan))
+	}
+	if notification := <-backendChan; !strings.Contains(notification, `"subscriptionId":"1"`) || !strings.Contains(notification, `"RouterId":"1?1"`) {
+		t.Errorf("unexpected notification to the first subscriber: %s", notification)
+	}
+	if notification := <-backendChan; !strings.Contains(notification, `"subscriptionId":"2"`) || !strings.Contains(notification, `"RouterId":"2?1"`) {
+		t.Errorf("unexpected notification to the second subscriber: %s", notification)
+	}
+
+	status, subscriptionList := deactivateSubscription(subscriptionList, "1") // the sampling continues for the second subscriber
+	if status != 1 || len(subscriptionList) != 1 || len(subscriptionList[0].subscribers) != 1 || subscriptionList[0].subscribers[0].subscriptionId != 2 {
+		t.Fatalf("unexpected subscriptions after the first unsubscribe: %+v", subscriptionList)
+	}
+	if status, _ = deactivateSubscription(subscriptionList, "1"); status != -1 {
+		t.Errorf("subscriber unsubscribed twice")
+	}
+	if _, subscriptionList = deactivateSubscription(subscriptionList, "2"); len(subscriptionList) != 0 {
+		t.Errorf("sampling not stopped after the last unsubscribe")
+	}
+}
+
+func TestCloseSharedCurveLogSampling(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	curveLogFilter, _ := utils.UnpackFilter(map[string]interface{}{"type": "curvelog", "value": map[string]interface{}{"maxerr": "0.5", "bufsize": "100"}})
+	subscriptionList := []SubscriptionState{
+		{subscriptionId: 1, subscribers: []Subscriber{{1, "1?1"}, {2, "2?1"}}, path: []string{"Vehicle.Speed"}, filterList: curveLogFilter, SubscriptionThreads: 1},
+		{subscriptionId: 3, subscribers: []Subscriber{{3, "3?1"}, {4, "4?1"}}, path: []string{"Vehicle.Acceleration.Lateral"}, filterList: curveLogFilter, SubscriptionThreads: 1},
+	}
+	backendChan := make(chan string, 10)
+	defer func() { closeClSubId = -1 }()
+
+	_, subscriptionList = deactivateSubscription(subscriptionList, "1")
+	_, subscriptionList = deactivateSubscription(subscriptionList, "2")
+	if closeClSubId != 1 || len(subscriptionList) != 2 {
+		t.Fatalf("curve logging sampling not closing, closeClSubId=%d", closeClSubId)
+	}
+	subscriptionList = sendCurveLogNotification(backendChan, CLPack{`{"value":"1", "ts":"2021-03-01T10:00:00Z"}`, 1}, subscriptionList)
+	if len(subscriptionList) != 1 || subscriptionList[0].subscriptionId != 3 {
+		t.Fatalf("closed sampling not removed: %+v", subscriptionList)
+	}
+	if len(backendChan) != 0 {
+		t.Errorf("data of the closed sampling sent to the subscribers of another sampling: %s", <-backendChan)
+	}
+
+	_, subscriptionList = deactivateSubscription(subscriptionList, "3")
+	_, subscriptionList = deactivateSubscription(subscriptionList, "4")
+	subscriptionList = sendCurveLogNotification(backendChan, CLPack{`{"value":"1", "ts":"2021-03-01T10:00:00Z"}`, 3}, subscriptionList) // the last element of the list
+	if len(subscriptionList) != 0 || len(backendChan) != 0 {
+		t.Errorf("last closed sampling not removed without notification")
+	}
+}
+
+func TestServiceDataSessionReconnection(t *testing.T) {
+	utils.InitLog("service-mgr-log.txt", "./logs", false, "error")
+	dataChan := make(chan string)
+	backendChan := make(chan string, BACKEND_CHAN_SIZE)
+	server := httptest.NewServer(http.HandlerFunc(makeServiceDataHandler(dataChan, backendChan)))
+	defer server.Close()
+	sessionUrl := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	oldConn, _, err := websocket.DefaultDialer.Dial(sessionUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldConn.Close()
+	for i := 0; i < BACKEND_CHAN_SIZE+1; i++ { // the server core is not reading, the main loop must not block
+		sendNotification(backendChan, `{"action":"subscription", "subscriptionId":"1"}`)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(sessionUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"get", "requestId":"1"}`)) // answered when the new session has started
+	<-dataChan
+	dataChan <- `{"action":"get", "requestId":"1"}`
+	if _, response, err := conn.ReadMessage(); err != nil || !strings.Contains(string(response), `"requestId":"1"`) {
+		t.Fatalf("unexpected response %s, err=%v", response, err)
+	}
+
+	for i := 2; i < 5; i++ { // with a stale session left reading the backend channel, some would be lost
+		sendNotification(backendChan, `{"action":"subscription", "subscriptionId":"`+strconv.Itoa(i)+`"}`)
+		if _, notification, err := conn.ReadMessage(); err != nil || !strings.Contains(string(notification), `"subscriptionId":"`+strconv.Itoa(i)+`"`) {
+			t.Fatalf("unexpected notification %s, err=%v", notification, err)
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	for err == nil { // the session has stopped when the connection is closed
+		_, _, err = conn.ReadMessage()
+	}
+}
+
+func TestServiceInstance(t *testing.T) {
+	defer func() { utils.Config = utils.DefaultConfig() }()
+	for _, test := range []struct {
+		fname    string
+		rootNode string
+		expected string
+	}{
+		{"history.db", "Vehicle", "history.db"},
+		{"../data/history.db", "Vehicle.Private.OEM", "../data/history-Vehicle.Private.OEM.db"},
+		{DEFAULT_UDS_PATH, "Vehicle.Private", "/tmp/vissv2/histctrlserver-Vehicle.Private.sock"},
+		{"", "Vehicle.Private", ""}, // kept in memory
+	} {
+		if fname := getInstanceFileName(test.fname, test.rootNode); fname != test.expected {
+			t.Errorf("getInstanceFileName(%s, %s)=%s", test.fname, test.rootNode, fname)
+		}
+	}
+	if port := getMetricsPort(RegResponse{Portnum: utils.Config.Ports.ServiceData + 2}); port != utils.Config.MetricsPorts.ServiceMgr+2 {
+		t.Errorf("metrics port %d of service index 2", port)
+	}
+	utils.Config.MetricsPorts.ServiceMgr = 0
+	if port := getMetricsPort(RegResponse{Portnum: utils.Config.Ports.ServiceData + 2}); port != 0 {
+		t.Errorf("disabled metrics served on port %d", port)
+	}
+}
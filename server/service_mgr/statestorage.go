@@ -0,0 +1,193 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+/**
+* The sqlite backend reads and writes the VSS_MAP(path, value, timestamp) table of a state storage database,
+* which is updated by the vehicle system. Only signals having a row in the table can be set.
+* Without the database file the backend is not available, and all signals have dummy values.
+* Changes are detected with the change log table VSS_CHANGES, which is filled by triggers on VSS_MAP with the path of every inserted or updated row,
+* also when the row is written by another process. The table is read with one query per changeLogInterval for all signals,
+* and rows older than changeLogRetention are deleted, so that several service managers can share the database.
+**/
+
+const changeLogInterval = 10 * time.Millisecond
+const changeLogRetention = 60 // seconds
+
+const changeLogSchema = `CREATE TABLE IF NOT EXISTS VSS_CHANGES (seq INTEGER PRIMARY KEY AUTOINCREMENT, path TEXT, changed REAL DEFAULT (julianday('now')));
+CREATE TRIGGER IF NOT EXISTS VSS_MAP_UPDATED AFTER UPDATE OF value, timestamp ON VSS_MAP BEGIN INSERT INTO VSS_CHANGES(path) VALUES (NEW.path); END;
+CREATE TRIGGER IF NOT EXISTS VSS_MAP_INSERTED AFTER INSERT ON VSS_MAP BEGIN INSERT INTO VSS_CHANGES(path) VALUES (NEW.path); END;`
+
+type SqliteBackend struct {
+	db   *sql.DB
+	done chan struct{}
+}
+
+func init() {
+	registerBackend("sqlite", newSqliteBackend)
+}
+
+func newSqliteBackend(config utils.ServiceMgrConfig) (VehicleDataBackend, error) {
+	if !utils.FileExists(config.DbFile) {
+		utils.Warning.Printf("State storage file %s not found, dummy values are used", config.DbFile)
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite3", config.DbFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open DB file = %s, err = %s", config.DbFile, err)
+	}
+	return &SqliteBackend{db, make(chan struct{})}, nil
+}
+
+func (sb *SqliteBackend) Get(path string) (string, string, error) {
+	rows, err := sb.db.Query("SELECT `value`, `timestamp` FROM VSS_MAP WHERE `path`=?", path)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", "", errNoValue
+	}
+	value := ""
+	timestamp := ""
+	err = rows.Scan(&value, &timestamp)
+	if err != nil {
+		return "", "", err
+	}
+	return value, timestamp, nil
+}
+
+/**
+* Set updates the paths in one statestorage transaction, so either all or none of them are updated.
+* A path that is not in the statestorage fails the update.
+**/
+func (sb *SqliteBackend) Set(paths []string, values []string) (string, error) {
+	tx, err := sb.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("could not begin statestorage transaction, err = %s", err)
+	}
+	stmt, err := tx.Prepare("UPDATE VSS_MAP SET value=?, timestamp=? WHERE `path`=?")
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("could not prepare for statestorage updating, err = %s", err)
+	}
+	defer stmt.Close()
+
+	ts := utils.GetRfcTime()
+	for i := 0; i < len(paths); i++ {
+		result, err := stmt.Exec(values[i], ts, paths[i])
+		if err == nil {
+			var rows int64
+			rows, err = result.RowsAffected()
+			if err == nil && rows != 1 {
+				err = fmt.Errorf("%s not found", paths[i])
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return "", fmt.Errorf("could not update statestorage, err = %s", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", fmt.Errorf("could not commit statestorage update, err = %s", err)
+	}
+	return ts, nil
+}
+
+/**
+* Subscribe creates the change log table and its triggers if they do not exist, which fails for a read-only database.
+**/
+func (sb *SqliteBackend) Subscribe(changeChan chan string) error {
+	if _, err := sb.db.Exec(changeLogSchema); err != nil {
+		utils.Warning.Printf("Could not create the statestorage change log, err = %s", err)
+		return errChangesNotSupported
+	}
+	var lastSeq int64
+	if err := sb.db.QueryRow("SELECT IFNULL(MAX(seq), 0) FROM VSS_CHANGES").Scan(&lastSeq); err != nil {
+		utils.Warning.Printf("Could not read the statestorage change log, err = %s", err)
+		return errChangesNotSupported
+	}
+	go sb.watchChanges(changeChan, lastSeq)
+	return nil
+}
+
+func (sb *SqliteBackend) watchChanges(changeChan chan string, lastSeq int64) {
+	ticker := time.NewTicker(changeLogInterval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-sb.done:
+			return
+		case <-ticker.C:
+		}
+		var changedPaths []string
+		lastSeq, changedPaths = sb.readChanges(lastSeq)
+		for _, path := range changedPaths {
+			select {
+			case changeChan <- path:
+			case <-sb.done:
+				return
+			}
+		}
+		if time.Since(lastPrune) > changeLogRetention*time.Second {
+			_, err := sb.db.Exec("DELETE FROM VSS_CHANGES WHERE changed < julianday('now', ?)", fmt.Sprintf("-%d seconds", changeLogRetention))
+			if err != nil {
+				utils.Warning.Printf("Could not prune the statestorage change log, err = %s", err)
+			}
+			lastPrune = time.Now()
+		}
+	}
+}
+
+/**
+* readChanges returns the last read sequence number, and the distinct paths changed after lastSeq.
+**/
+func (sb *SqliteBackend) readChanges(lastSeq int64) (int64, []string) {
+	rows, err := sb.db.Query("SELECT seq, path FROM VSS_CHANGES WHERE seq > ? ORDER BY seq", lastSeq)
+	if err != nil {
+		utils.Warning.Printf("Could not read the statestorage change log, err = %s", err)
+		return lastSeq, nil
+	}
+	defer rows.Close()
+	var changedPaths []string
+	isChanged := map[string]bool{}
+	for rows.Next() {
+		var seq int64
+		var path string
+		if err := rows.Scan(&seq, &path); err != nil {
+			break
+		}
+		lastSeq = seq
+		if !isChanged[path] {
+			isChanged[path] = true
+			changedPaths = append(changedPaths, path)
+		}
+	}
+	return lastSeq, changedPaths
+}
+
+func (sb *SqliteBackend) Metadata(path string) DataMetadata {
+	return DataMetadata{Source: "statestorage"}
+}
+
+func (sb *SqliteBackend) Close() error {
+	close(sb.done)
+	return sb.db.Close()
+}
@@ -74,6 +74,7 @@ func main() {
 		Required: false,
 		Help:     "changes log output level",
 		Default:  "info"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -83,6 +84,7 @@ func main() {
 
 	utils.TransportErrorMessage = "WS transport mgr-finalizeResponse: JSON encode failed."
 	utils.InitLog("ws-mgr-log.txt", "./logs", *logFile, *logLevel)
+	utils.InitConfig(*configFile)
 	//ip := utils.GetServerIP()
 
 	utils.Info.Printf("WSMGR serverIP:%s", utils.GetServerIP())
@@ -90,6 +92,7 @@ func main() {
 	regData := utils.RegData{}
 
 	utils.RegisterAsTransportMgr(&regData, "WebSocket")
+	go utils.ServeMetrics(utils.Config.MetricsPorts.WsMgr)
 
 	utils.ReadTransportSecConfig()
 
@@ -0,0 +1,48 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package treemgr
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
+)
+
+/**
+* VSS JSON export:
+* ReadJsonTree builds the tree from a file generated by the vss-tools JSON exporter, without the need of the binary tree tooling.
+* The export has the same nested format as an overlay file, so the tree is built by applying the export to an empty root node.
+* Export members that have no counterpart in the tree, e.g. deprecation, are ignored,
+* and datatypes not supported by the tree datamodel are left unset, as when the binary format is read.
+**/
+func ReadJsonTree(treeFname string) (*gomodel.Node_t, error) {
+	data, err := ioutil.ReadFile(treeFname)
+	if err != nil {
+		return nil, err
+	}
+	var export OverlayChildren
+	if err = json.Unmarshal(data, &export); err != nil {
+		return nil, errors.New(treeFname + ": " + err.Error())
+	}
+	if len(export.names) != 1 {
+		return nil, errors.New(treeFname + ": the tree must have one root node")
+	}
+	rootName := export.names[0]
+	if export.nodes[rootName].Type != "branch" {
+		return nil, errors.New(treeFname + ": the root node must be a branch")
+	}
+	root := &gomodel.Node_t{Name: rootName}
+	if err = mergeNode(root, export.nodes[rootName], rootName, false); err != nil {
+		ReleaseTree(root)
+		return nil, errors.New(treeFname + ": " + err.Error())
+	}
+	return root, nil
+}
@@ -0,0 +1,118 @@
+package treemgr
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
+	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+)
+
+/**
+* exportNode generates the vss-tools JSON export of the node, and recursively its children.
+**/
+func exportNode(node *gomodel.Node_t) string {
+	member := func(name string, value string) string {
+		if len(value) == 0 {
+			return ""
+		}
+		jsonValue, _ := json.Marshal(value)
+		return `,"` + name + `":` + string(jsonValue)
+	}
+	export := `{"type":"` + gomodel.NodetypeToString(node.NodeType) + `"`
+	export += member("uuid", node.Uuid) + member("description", node.Description) + member("datatype", gomodel.DataTypeToString(node.Datatype))
+	export += member("unit", node.Unit) + member("min", node.Min) + member("max", node.Max) + member("default", node.DefaultEnum)
+	export += member("validate", gomodel.ValidateToString(node.Validate))
+	if node.Enums > 0 {
+		allowed, _ := json.Marshal(node.EnumDef)
+		export += `,"allowed":` + string(allowed)
+	}
+	if len(node.Child) > 0 {
+		var children []string
+		for _, child := range node.Child {
+			children = append(children, `"`+child.Name+`":`+exportNode(child))
+		}
+		export += `,"children":{` + strings.Join(children, ",") + `}`
+	}
+	return export + "}"
+}
+
+func compareNodes(t *testing.T, expected *gomodel.Node_t, actual *gomodel.Node_t, path string) {
+	if expected.Name != actual.Name || expected.NodeType != actual.NodeType || expected.Uuid != actual.Uuid || expected.Description != actual.Description ||
+		expected.Datatype != actual.Datatype || expected.Unit != actual.Unit || expected.Min != actual.Min || expected.Max != actual.Max ||
+		expected.Enums != actual.Enums || strings.Join(expected.EnumDef, ",") != strings.Join(actual.EnumDef, ",") ||
+		expected.DefaultEnum != actual.DefaultEnum || expected.Validate != actual.Validate || expected.Children != actual.Children {
+		t.Fatalf("%s differs:\nexpected %+v\nactual   %+v", path, *expected, *actual)
+	}
+	for i := 0; i < len(expected.Child); i++ {
+		if actual.Child[i].Parent != actual {
+			t.Fatalf("%s has wrong parent", path)
+		}
+		compareNodes(t, expected.Child[i], actual.Child[i], path+"."+expected.Child[i].Name)
+	}
+}
+
+func TestReadJsonTree(t *testing.T) {
+	binaryRoot := golib.VSSReadTree(testTreeFname)
+	jsonFname := writeTestFile(t, "vss.json", `{"Vehicle":`+exportNode(binaryRoot)+`}`)
+	jsonRoot, err := ReadTree(jsonFname, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	compareNodes(t, binaryRoot, jsonRoot, "Vehicle")
+
+	expectedData, expectedMatches := golib.VSSsearchNodes("Vehicle.Cabin.Door.*.*.IsOpen", binaryRoot, 100, true, true, 0, nil, nil)
+	searchData, matches := golib.VSSsearchNodes("Vehicle.Cabin.Door.*.*.IsOpen", jsonRoot, 100, true, true, 0, nil, nil)
+	if matches == 0 || matches != expectedMatches || searchData[matches-1].NodePath != expectedData[matches-1].NodePath {
+		t.Errorf("wildcard search found %d matches, expected %d", matches, expectedMatches)
+	}
+}
+
+func TestReadJsonTreeExportMembers(t *testing.T) {
+	longDescription := strings.Repeat("x", 300)
+	jsonFname := writeTestFile(t, "vss.json", `{"Vehicle":{"type":"branch","description":"High-level vehicle data.","children":{
+		"TraveledDistance":{"type":"sensor","datatype":"uint64","unit":"km","comment":"Kept by the tree manager.","description":"`+longDescription+`"},
+		"Gear":{"type":"actuator","datatype":"int8","allowed":[-1,0,1],"default":0,"min":-1,"max":1.5}}}}`)
+	root, err := ReadJsonTree(jsonFname)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if root.Children != 2 || root.Child[0].Name != "TraveledDistance" || root.Child[1].Name != "Gear" {
+		t.Fatalf("children not in file order")
+	}
+	distance, gear := root.Child[0], root.Child[1]
+	if distance.Datatype != 0 || distance.Unit != "km" || distance.Description != longDescription {
+		t.Errorf("unexpected members %+v", *distance)
+	}
+	if gear.Enums != 3 || gear.EnumDef[0] != "-1" || gear.DefaultEnum != "0" || gear.Min != "-1" || gear.Max != "1.5" {
+		t.Errorf("unexpected members %+v", *gear)
+	}
+	if metadata := JsonifyTreeNode(distance, "", 0, 1); !strings.Contains(metadata, `"comment":"Kept by the tree manager."`) {
+		t.Errorf("comment missing in the metadata %s", metadata)
+	}
+	if metadata := JsonifyTreeNode(gear, "", 0, 1); strings.Contains(metadata, "comment") {
+		t.Errorf("unexpected comment in the metadata %s", metadata)
+	}
+	ReleaseTree(root)
+	if metadata := JsonifyTreeNode(distance, "", 0, 1); strings.Contains(metadata, "comment") {
+		t.Errorf("comment of a released tree in the metadata %s", metadata)
+	}
+
+	binaryFname := filepath.Join(t.TempDir(), "vss.binary")
+	WriteTree(binaryFname, root)
+	if len(distance.Description) != 300 {
+		t.Errorf("the tree was modified when written")
+	}
+	binaryRoot := golib.VSSReadTree(binaryFname)
+	if binaryRoot.Child[0].Description != longDescription[:maxMemberLen] || binaryRoot.Child[1].Max != "1.5" {
+		t.Errorf("unexpected binary tree %+v", *binaryRoot.Child[0])
+	}
+
+	for _, malformed := range []string{`{"Vehicle":{"type":"sensor"}}`, `{"A":{"type":"branch"},"B":{"type":"branch"}}`, `["Vehicle"]`} {
+		if _, err := ReadJsonTree(writeTestFile(t, "vss.json", malformed)); err == nil {
+			t.Errorf("malformed tree accepted: %s", malformed)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package treemgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
+	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+)
+
+/**
+* VSS overlays:
+* An overlay file has the nested structure of the vss-tools JSON export, where each node is an object having the node name as key,
+* and the node members type, description, comment, uuid, datatype, unit, min, max, allowed, default, validate, and children.
+* A node in the overlay that does not exist in the tree is added, and must then have the type member.
+* For a node that exists in the tree, the members in the overlay override the members of the tree node, and its children are merged.
+* A node having the member "delete":true is deleted from the tree, together with its subtree.
+* Overlays are applied in the order given, so a later overlay can modify nodes added by an earlier one.
+**/
+
+const maxChildren = 255
+const maxMemberLen = 255 // max length of a string member in the binary tree format
+
+type OverlayNode struct {
+	Type        string          `json:"type"`
+	Description *string         `json:"description"`
+	Comment     *string         `json:"comment"`
+	Uuid        *string         `json:"uuid"`
+	Datatype    string          `json:"datatype"`
+	Unit        *string         `json:"unit"`
+	Min         interface{}     `json:"min"`
+	Max         interface{}     `json:"max"`
+	Allowed     []interface{}   `json:"allowed"`
+	Default     interface{}     `json:"default"`
+	Validate    *string         `json:"validate"`
+	Delete      bool            `json:"delete"`
+	Children    OverlayChildren `json:"children"`
+}
+
+/**
+* OverlayChildren keeps the children in the order of the file, so that added nodes are ordered as written.
+**/
+type OverlayChildren struct {
+	names []string
+	nodes map[string]OverlayNode
+}
+
+func (children *OverlayChildren) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return errors.New("children must be an object")
+	}
+	children.nodes = make(map[string]OverlayNode)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		var node OverlayNode
+		if err = decoder.Decode(&node); err != nil {
+			return err
+		}
+		if _, exists := children.nodes[name]; !exists {
+			children.names = append(children.names, name)
+		}
+		children.nodes[name] = node
+	}
+	return nil
+}
+
+/**
+* ReadTree reads the tree file, and applies the overlay files to it.
+* A tree file with the extension .json is read as a vss-tools JSON export, else it is read as a binary tree file.
+**/
+func ReadTree(treeFname string, overlayFnames []string) (*gomodel.Node_t, error) {
+	var root *gomodel.Node_t
+	if filepath.Ext(treeFname) == ".json" {
+		var err error
+		if root, err = ReadJsonTree(treeFname); err != nil {
+			return nil, err
+		}
+	} else if root = golib.VSSReadTree(treeFname); root == nil {
+		return nil, errors.New("could not read tree file " + treeFname)
+	}
+	for _, overlayFname := range overlayFnames {
+		if err := ApplyOverlay(root, overlayFname); err != nil {
+			ReleaseTree(root)
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+/**
+* WriteTree saves the tree in the binary format, e.g. for a merged tree to be read by a binary format parser.
+* String members longer than the binary format allows are truncated, and allowed values that do not fit are dropped.
+**/
+func WriteTree(treeFname string, root *gomodel.Node_t) {
+	os.Remove(treeFname) // VSSWriteTree() does not truncate an existing file
+	golib.VSSWriteTree(treeFname, binaryFormatCopy(root, nil))
+}
+
+func binaryFormatCopy(node *gomodel.Node_t, parent *gomodel.Node_t) *gomodel.Node_t {
+	nodeCopy := *node
+	nodeCopy.Parent = parent
+	for _, member := range []*string{&nodeCopy.Name, &nodeCopy.Uuid, &nodeCopy.Description, &nodeCopy.Min, &nodeCopy.Max, &nodeCopy.Unit, &nodeCopy.DefaultEnum} {
+		if len(*member) > maxMemberLen {
+			*member = (*member)[:maxMemberLen]
+		}
+	}
+	enumStrLen := 0
+	for i := 0; i < len(nodeCopy.EnumDef); i++ { // each element is preceded by a two character length in the enum string
+		enumStrLen += len(nodeCopy.EnumDef[i]) + 2
+		if enumStrLen > maxMemberLen {
+			nodeCopy.EnumDef = nodeCopy.EnumDef[:i]
+			nodeCopy.Enums = uint8(i)
+			break
+		}
+	}
+	nodeCopy.Child = make([]*gomodel.Node_t, len(node.Child))
+	for i := 0; i < len(node.Child); i++ {
+		nodeCopy.Child[i] = binaryFormatCopy(node.Child[i], &nodeCopy)
+	}
+	return &nodeCopy
+}
+
+func ApplyOverlay(root *gomodel.Node_t, overlayFname string) error {
+	data, err := ioutil.ReadFile(overlayFname)
+	if err != nil {
+		return err
+	}
+	var overlay map[string]OverlayNode
+	if err = json.Unmarshal(data, &overlay); err != nil {
+		return errors.New(overlayFname + ": " + err.Error())
+	}
+	for name, overlayNode := range overlay {
+		if name != root.Name {
+			return errors.New(overlayFname + ": root node must be " + root.Name)
+		}
+		if overlayNode.Delete {
+			return errors.New(overlayFname + ": the root node cannot be deleted")
+		}
+		if err = mergeNode(root, overlayNode, root.Name, true); err != nil {
+			return errors.New(overlayFname + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func findChild(node *gomodel.Node_t, name string) int {
+	for i := 0; i < len(node.Child); i++ {
+		if node.Child[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+/**
+* mergeNode applies the overlay node to the tree node, and recursively to its children.
+* An unknown datatype is an error in an overlay, while it is left unset when a tree is read, as the binary tree parser does.
+**/
+func mergeNode(node *gomodel.Node_t, overlayNode OverlayNode, path string, isOverlay bool) error {
+	if err := setNodeMembers(node, overlayNode, path, isOverlay); err != nil {
+		return err
+	}
+	for _, name := range overlayNode.Children.names {
+		overlayChild := overlayNode.Children.nodes[name]
+		childPath := path + "." + name
+		index := findChild(node, name)
+		if overlayChild.Delete {
+			if index == -1 {
+				return errors.New("cannot delete unknown node " + childPath)
+			}
+			node.Child = append(node.Child[:index], node.Child[index+1:]...)
+			node.Children--
+			continue
+		}
+		if index == -1 {
+			if len(overlayChild.Type) == 0 {
+				return errors.New("type missing for new node " + childPath)
+			}
+			if node.NodeType != gomodel.BRANCH {
+				return errors.New("cannot add node " + childPath + " to a leaf node")
+			}
+			if len(node.Child) == maxChildren {
+				return errors.New("too many children of " + path)
+			}
+			node.Child = append(node.Child, &gomodel.Node_t{Name: name, Parent: node})
+			node.Children++
+			index = len(node.Child) - 1
+		}
+		if err := mergeNode(node.Child[index], overlayChild, childPath, isOverlay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setNodeMembers(node *gomodel.Node_t, overlayNode OverlayNode, path string, isOverlay bool) error {
+	if len(overlayNode.Type) > 0 {
+		nodeType := gomodel.NodeTypes_t(gomodel.StringToNodetype(overlayNode.Type))
+		if nodeType == 0 {
+			return errors.New("unknown type " + overlayNode.Type + " of " + path)
+		}
+		if nodeType != gomodel.BRANCH && len(node.Child) > 0 {
+			return errors.New("branch " + path + " having children cannot be changed to " + overlayNode.Type)
+		}
+		node.NodeType = nodeType
+	}
+	if len(overlayNode.Datatype) > 0 {
+		datatype := gomodel.NodeDatatypes_t(gomodel.StringToDataType(overlayNode.Datatype))
+		if datatype == 0 && isOverlay {
+			return errors.New("unknown datatype " + overlayNode.Datatype + " of " + path)
+		}
+		node.Datatype = datatype
+	}
+	setString := func(member *string, value *string) {
+		if value != nil {
+			*member = *value
+		}
+	}
+	setString(&node.Description, overlayNode.Description)
+	if overlayNode.Comment != nil {
+		setComment(node, *overlayNode.Comment)
+	}
+	setString(&node.Uuid, overlayNode.Uuid)
+	setString(&node.Unit, overlayNode.Unit)
+	setString(&node.Min, scalarToString(overlayNode.Min))
+	setString(&node.Max, scalarToString(overlayNode.Max))
+	setString(&node.DefaultEnum, scalarToString(overlayNode.Default))
+	if overlayNode.Validate != nil {
+		if *overlayNode.Validate != "" && gomodel.ValidateToInt(*overlayNode.Validate) == 0 {
+			return errors.New("unknown validate value " + *overlayNode.Validate + " of " + path)
+		}
+		node.Validate = gomodel.ValidateToInt(*overlayNode.Validate)
+	}
+	if overlayNode.Allowed != nil {
+		if len(overlayNode.Allowed) > maxChildren {
+			return errors.New("too many allowed values of " + path)
+		}
+		node.EnumDef = make([]string, 0, len(overlayNode.Allowed))
+		for _, allowed := range overlayNode.Allowed {
+			if value := scalarToString(allowed); value != nil {
+				node.EnumDef = append(node.EnumDef, *value)
+			}
+		}
+		node.Enums = uint8(len(node.EnumDef))
+	}
+	return nil
+}
+
+func scalarToString(value interface{}) *string {
+	var str string
+	switch typedValue := value.(type) {
+	case nil:
+		return nil
+	case string:
+		str = typedValue
+	case float64:
+		str = strconv.FormatFloat(typedValue, 'f', -1, 64)
+	case bool:
+		str = strconv.FormatBool(typedValue)
+	default:
+		return nil
+	}
+	return &str
+}
@@ -0,0 +1,78 @@
+package treemgr
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
+	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+)
+
+const testTreeFname = "../server/server_core/vss_vissv2.binary"
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	fname := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func searchNode(root *gomodel.Node_t, path string) *gomodel.Node_t {
+	searchData, matches := golib.VSSsearchNodes(path, root, 10, false, false, 0, nil, nil)
+	for i := 0; i < matches; i++ {
+		if searchData[i].NodePath == path {
+			return searchData[i].NodeHandle
+		}
+	}
+	return nil
+}
+
+func TestApplyOverlay(t *testing.T) {
+	overlay1 := writeTestFile(t, "overlay1.json", `{"Vehicle":{"children":{
+		"Private":{"type":"branch","description":"Private branch.","children":{
+			"OEM":{"type":"branch","description":"OEM signals.","children":{
+				"Mode":{"type":"actuator","datatype":"string","description":"Drive mode.","allowed":["ECO","SPORT"],"default":"ECO","validate":"read-write"}}}}},
+		"Speed":{"unit":"m/s","max":70},
+		"Cabin":{"children":{"Sunroof":{"delete":true}}}}}}`)
+	overlay2 := writeTestFile(t, "overlay2.json", `{"Vehicle":{"children":{"Private":{"children":{"OEM":{"children":{"Mode":{"description":"Selected drive mode."}}}}}}}}`)
+	root, err := ReadTree(testTreeFname, []string{overlay1, overlay2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	mode := searchNode(root, "Vehicle.Private.OEM.Mode")
+	if mode == nil || mode.NodeType != gomodel.ACTUATOR || mode.Enums != 2 || mode.DefaultEnum != "ECO" || mode.Validate != 2 {
+		t.Fatalf("node not added: %+v", mode)
+	}
+	if mode.Description != "Selected drive mode." {
+		t.Errorf("second overlay not applied: %s", mode.Description)
+	}
+	if speed := searchNode(root, "Vehicle.Speed"); speed.Unit != "m/s" || speed.Max != "70" || speed.Description == "" {
+		t.Errorf("node not overridden: %+v", speed)
+	}
+	if searchNode(root, "Vehicle.Cabin.Sunroof") != nil {
+		t.Errorf("node not deleted")
+	}
+
+	merged := filepath.Join(t.TempDir(), "merged.binary")
+	WriteTree(merged, root)
+	if searchNode(golib.VSSReadTree(merged), "Vehicle.Private.OEM.Mode") == nil {
+		t.Errorf("added node not in the written tree")
+	}
+}
+
+func TestApplyOverlayErrors(t *testing.T) {
+	malformed := []string{
+		`{"Vehicle":{"children":{"NoType":{"description":"X"}}}}`,
+		`{"Vehicle":{"children":{"Cabin":{"type":"sensor"}}}}`,
+		`{"Vehicle":{"children":{"Unknown":{"delete":true}}}}`,
+		`{"Vehicle":{"children":{"Speed":{"datatype":"float64"}}}}`,
+		`{"Car":{}}`,
+	}
+	for _, overlay := range malformed {
+		if _, err := ReadTree(testTreeFname, []string{writeTestFile(t, "overlay.json", overlay)}); err == nil {
+			t.Errorf("malformed overlay accepted: %s", overlay)
+		}
+	}
+}
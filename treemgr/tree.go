@@ -0,0 +1,259 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package treemgr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	gomodel "github.com/GENIVI/vss-tools/binary/go_parser/datamodel"
+	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+)
+
+/**
+* Tree access:
+* The server core and the access token server access the VSS tree only via this package, so that they agree on search results and wildcard expansion.
+* A tree is never modified after it has been read, so it can be searched concurrently.
+**/
+
+const MaxFoundNodes = 1500
+
+type Node_t = gomodel.Node_t
+type SearchData_t = golib.SearchData_t
+
+type PathList struct {
+	LeafPaths []string
+}
+
+/**
+* SearchNodes returns the number of nodes matching the path, which may contain wildcards, and the search data of each match.
+* If validation is not nil it is set to the highest access restriction found among the matching nodes.
+**/
+func SearchNodes(root *Node_t, path string, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string, validation *int) (int, []SearchData_t) {
+	if len(path) == 0 {
+		return 0, nil
+	}
+	searchData, matches := golib.VSSsearchNodes(path, root, MaxFoundNodes, anyDepth, leafNodesOnly, listSize, noScopeList, validation)
+	return matches, searchData
+}
+
+/**
+* ExpandWildcardPath returns the paths of the leaf nodes matching a path containing wildcards. A path without wildcards is returned as is.
+**/
+func ExpandWildcardPath(root *Node_t, path string) []string {
+	if !strings.Contains(path, "*") {
+		return []string{path}
+	}
+	matches, searchData := SearchNodes(root, path, true, true, 0, nil, nil)
+	paths := make([]string, matches)
+	for i := 0; i < matches; i++ {
+		paths[i] = searchData[i].NodePath
+	}
+	return paths
+}
+
+/**
+* LeafPaths returns the sorted paths of all leaf nodes of the tree.
+**/
+func LeafPaths(root *Node_t) []string {
+	var paths []string
+	var addLeafPaths func(node *Node_t, path string)
+	addLeafPaths = func(node *Node_t, path string) {
+		if node.NodeType != gomodel.BRANCH {
+			paths = append(paths, path)
+			return
+		}
+		for _, child := range node.Child {
+			addLeafPaths(child, path+"."+child.Name)
+		}
+	}
+	addLeafPaths(root, root.Name)
+	sort.Strings(paths)
+	return paths
+}
+
+/**
+* WritePathList saves the leaf paths in a temporary file that then replaces the list file,
+* so that readers of the list never read a partially written list.
+**/
+func WritePathList(root *Node_t, listFname string) error {
+	data, err := json.Marshal(PathList{LeafPaths(root)})
+	if err != nil {
+		return err
+	}
+	tmpFname := listFname + ".tmp"
+	if err = ioutil.WriteFile(tmpFname, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFname, listFname)
+}
+
+// nativeCnodeDef.h: nodeTypes_t;
+func nodeTypesToString(nodeType int) string {
+	switch nodeType {
+	case 1:
+		return "sensor"
+	case 2:
+		return "actuator"
+	case 3:
+		return "attribute"
+	case 4:
+		return "branch"
+	default:
+		return ""
+	}
+}
+
+// nativeCnodeDef.h: nodeDatatypes_t
+func nodeDataTypesToString(nodeType int) string {
+	switch nodeType {
+	case 1:
+		return "int8"
+	case 2:
+		return "uint8"
+	case 3:
+		return "int16"
+	case 4:
+		return "uint16"
+	case 5:
+		return "int32"
+	case 6:
+		return "uint32"
+	case 7:
+		return "double"
+	case 8:
+		return "float"
+	case 9:
+		return "boolean"
+	case 10:
+		return "string"
+	case 11, 12, 13, 14, 15, 16, 17, 18, 19, 20:
+		return nodeDataTypesToString(nodeType-10) + "[]"
+	default:
+		return ""
+	}
+}
+
+func jsonString(value string) string {
+	jsonValue, _ := json.Marshal(value) // escapes quotes and control characters
+	return string(jsonValue)
+}
+
+/**
+* The tree datamodel, as the binary format, has no comment member, so the comments of a tree read from the JSON format,
+* or set by overlays, are kept per tree until it is released.
+**/
+var treeComments = map[*Node_t]map[*Node_t]string{} // key is the root node of the tree
+var treeCommentsMutex sync.RWMutex
+
+func getRootNode(node *Node_t) *Node_t {
+	for node.Parent != nil {
+		node = node.Parent
+	}
+	return node
+}
+
+func setComment(node *Node_t, comment string) {
+	treeCommentsMutex.Lock()
+	defer treeCommentsMutex.Unlock()
+	root := getRootNode(node)
+	if treeComments[root] == nil {
+		treeComments[root] = make(map[*Node_t]string)
+	}
+	treeComments[root][node] = comment
+}
+
+func getComment(node *Node_t) string {
+	treeCommentsMutex.RLock()
+	defer treeCommentsMutex.RUnlock()
+	return treeComments[getRootNode(node)][node]
+}
+
+/**
+* ReleaseTree discards the comments of a tree that is no longer used, e.g. the previous tree after a reload.
+**/
+func ReleaseTree(root *Node_t) {
+	treeCommentsMutex.Lock()
+	defer treeCommentsMutex.Unlock()
+	delete(treeComments, root)
+}
+
+func addMetadataMember(jsonBuffer string, key string, value string) string {
+	if len(value) == 0 {
+		return jsonBuffer
+	}
+	return jsonBuffer + `"` + key + `":` + jsonString(value) + `,`
+}
+
+/**
+* JsonifyTreeNode serializes the node metadata in the VSS JSON format, and recursively its children until maxDepth is reached.
+* Metadata members that are not set in the tree are omitted. The serialization of each node is followed by a comma.
+**/
+func JsonifyTreeNode(nodeHandle *Node_t, jsonBuffer string, depth int, maxDepth int) string {
+	if depth >= maxDepth {
+		return jsonBuffer
+	}
+	depth++
+	var newJsonBuffer string
+	nodeName := golib.VSSgetName(nodeHandle)
+	newJsonBuffer += jsonString(nodeName) + `:{`
+	nodeType := int(golib.VSSgetType(nodeHandle))
+	newJsonBuffer += `"type":` + `"` + nodeTypesToString(nodeType) + `",`
+	newJsonBuffer = addMetadataMember(newJsonBuffer, "uuid", golib.VSSgetUUID(nodeHandle))
+	newJsonBuffer = addMetadataMember(newJsonBuffer, "description", golib.VSSgetDescr(nodeHandle))
+	newJsonBuffer = addMetadataMember(newJsonBuffer, "comment", getComment(nodeHandle))
+	nodeNumofChildren := golib.VSSgetNumOfChildren(nodeHandle)
+	switch nodeType {
+	case 4: // branch
+	case 1: // sensor
+		fallthrough
+	case 2: // actuator
+		fallthrough
+	case 3: // attribute
+		nodeDatatype := golib.VSSgetDatatype(nodeHandle)
+		newJsonBuffer = addMetadataMember(newJsonBuffer, "datatype", nodeDataTypesToString(int(nodeDatatype)))
+		newJsonBuffer = addMetadataMember(newJsonBuffer, "unit", golib.VSSgetUnit(nodeHandle))
+		newJsonBuffer = addMetadataMember(newJsonBuffer, "min", nodeHandle.Min)
+		newJsonBuffer = addMetadataMember(newJsonBuffer, "max", nodeHandle.Max)
+		numOfEnumElements := golib.VSSgetNumOfEnumElements(nodeHandle)
+		if numOfEnumElements > 0 {
+			newJsonBuffer += `"allowed":[`
+			for i := 0; i < numOfEnumElements; i++ {
+				newJsonBuffer += jsonString(golib.VSSgetEnumElement(nodeHandle, i)) + `,`
+			}
+			newJsonBuffer = newJsonBuffer[:len(newJsonBuffer)-1] + `],`
+		}
+		newJsonBuffer = addMetadataMember(newJsonBuffer, "default", nodeHandle.DefaultEnum)
+	default:
+		return ""
+
+	}
+	if depth < maxDepth {
+		if nodeNumofChildren > 0 {
+			newJsonBuffer += `"children":` + "{"
+		}
+		for i := 0; i < nodeNumofChildren; i++ {
+			childNode := golib.VSSgetChild(nodeHandle, i)
+			newJsonBuffer += JsonifyTreeNode(childNode, jsonBuffer, depth, maxDepth)
+		}
+		if nodeNumofChildren > 0 {
+			newJsonBuffer = newJsonBuffer[:len(newJsonBuffer)-1] // remove comma after curly bracket
+			newJsonBuffer += "}"
+		}
+	}
+	if newJsonBuffer[len(newJsonBuffer)-1] == ',' && newJsonBuffer[len(newJsonBuffer)-2] != '}' {
+		newJsonBuffer = newJsonBuffer[:len(newJsonBuffer)-1]
+	}
+	newJsonBuffer += "},"
+	return jsonBuffer + newJsonBuffer
+}
@@ -0,0 +1,74 @@
+package treemgr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	golib "github.com/GENIVI/vss-tools/binary/go_parser/parserlib"
+)
+
+func TestLeafPaths(t *testing.T) {
+	root, _ := ReadTree(testTreeFname, nil)
+	listFname := filepath.Join(t.TempDir(), "vsspathlist.json")
+	golib.VSSGetLeafNodesList(root, listFname)
+	data, _ := ioutil.ReadFile(listFname)
+	var expected PathList
+	if err := json.Unmarshal(data, &expected); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(expected.LeafPaths)
+
+	if err := WritePathList(root, listFname); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(listFname)
+	var actual PathList
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actual.LeafPaths, ",") != strings.Join(expected.LeafPaths, ",") {
+		t.Errorf("leaf path list differs from the parser lib list, %d and %d paths", len(actual.LeafPaths), len(expected.LeafPaths))
+	}
+}
+
+func TestExpandWildcardPath(t *testing.T) {
+	root, _ := ReadTree(testTreeFname, nil)
+	if paths := ExpandWildcardPath(root, "Vehicle.Speed"); len(paths) != 1 || paths[0] != "Vehicle.Speed" {
+		t.Errorf("path without wildcard expanded to %v", paths)
+	}
+	paths := ExpandWildcardPath(root, "Vehicle.Cabin.Door.*.*.IsOpen")
+	if len(paths) == 0 {
+		t.Fatalf("wildcard path not expanded")
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "Vehicle.Cabin.Door.Row") || !strings.HasSuffix(path, ".IsOpen") {
+			t.Errorf("unexpected path %s", path)
+		}
+	}
+	if paths := ExpandWildcardPath(root, "Vehicle.Unknown.*"); len(paths) != 0 {
+		t.Errorf("unknown path expanded to %v", paths)
+	}
+}
+
+func TestJsonifyTreeNode(t *testing.T) {
+	root, _ := ReadTree(testTreeFname, nil)
+	door := searchNode(root, "Vehicle.Cabin.Door")
+	jsonBuffer := JsonifyTreeNode(door, "", 0, 2)
+	var metadata map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte("{"+jsonBuffer[:len(jsonBuffer)-1]+"}"), &metadata); err != nil {
+		t.Fatalf("invalid metadata %s: %s", jsonBuffer, err)
+	}
+	children, ok := metadata["Door"]["children"].(map[string]interface{})
+	if metadata["Door"]["type"] != "branch" || !ok || len(children) != int(door.Children) {
+		t.Errorf("unexpected metadata %s", jsonBuffer)
+	}
+	for _, child := range children {
+		if _, hasChildren := child.(map[string]interface{})["children"]; hasChildren {
+			t.Errorf("metadata deeper than max depth %s", jsonBuffer)
+		}
+	}
+}
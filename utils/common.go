@@ -23,18 +23,17 @@ import (
         "time"
         "sort"
         "fmt"
+        "sync"
 )
 
 const IpModel = 0 // IpModel = [0,1,2] = [localhost,extIP,envVarIP]
 const IpEnvVarName = "GEN2MODULEIP"
 
+/**
+* GetServerIP returns the server core host from the configuration, see config.go.
+**/
 func GetServerIP() string {
-	if value, ok := os.LookupEnv(IpEnvVarName); ok {
-		Info.Println("ServerIP:", value)
-		return value
-	}
-	Error.Printf("Environment variable %s is not set defaulting to localhost.", IpEnvVarName)
-	return "localhost" //fallback
+	return Config.Hosts.ServerCore
 }
 
 func GetModelIP(ipModel int) string {
@@ -42,12 +41,7 @@ func GetModelIP(ipModel int) string {
 		return "localhost"
 	}
 	if ipModel == 2 {
-		if value, ok := os.LookupEnv(IpEnvVarName); ok {
-			Info.Println("Host IP:", value)
-			return value
-		}
-		Error.Printf("Environment variable %s error.", IpEnvVarName)
-		return "localhost" //fallback
+		return Config.Hosts.ServerCore // the GEN2MODULEIP environment variable is applied by LoadConfig()
 	}
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
@@ -145,25 +139,11 @@ func ExtractFromToken(token string, claim string) string { // TODO remove white
 	return ""
 }
 
-func SetErrorResponse(reqMap map[string]interface{}, errRespMap map[string]interface{}, number string, reason string, message string) {
-	if reqMap["RouterId"] != nil {
-		errRespMap["RouterId"] = reqMap["RouterId"]
-	}
-	if reqMap["action"] != nil {
-		errRespMap["action"] = reqMap["action"]
-	}
-	if reqMap["requestId"] != nil {
-		errRespMap["requestId"] = reqMap["requestId"]
-	}
-	errRespMap["error"] = `{"number":` + number + `,"reason":"` + reason + `","message":"` + message + `"}`
-        errRespMap["ts"] = GetRfcTime()
-}
-
 func FinalizeMessage(responseMap map[string]interface{}) string {
 	response, err := json.Marshal(responseMap)
 	if err != nil {
 		Error.Print("Server core-FinalizeMessage: JSON encode failed. ", err)
-		return `{"error":{"number":400,"reason":"JSON marshal error","message":""}}` //???
+		return `{"error":{"number":400,"reason":"bad_request","message":"JSON marshal error."}}`
 	}
 	return string(response)
 }
@@ -195,70 +175,13 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-type FilterObject struct {
-    Type string
-    Value string
-}
-
-func UnpackFilter(filter interface{}, fList *[]FilterObject) {  // See VISSv CORE, Filtering chapter for filter structure
-    switch vv := filter.(type) {
-      case []interface{}:
-        Info.Println(filter, "is an array:, len=",strconv.Itoa(len(vv)))
-        *fList = make([]FilterObject, len(vv))
-  	unpackFilterLevel1(vv, fList)
-      case map[string]interface{}:
-        Info.Println(filter, "is a map:")
-        *fList = make([]FilterObject, 1)
-        unpackFilterLevel2(0, vv, fList)
-      default:
-        Info.Println(filter, "is of an unknown type")
-    }
-}
-
-func unpackFilterLevel1(filterArray []interface{}, fList *[]FilterObject) {
-    i := 0
-    for k, v := range filterArray {
-        switch vv := v.(type) {
-          case map[string]interface{}:
-            Info.Println(k, "is a map:")
-            unpackFilterLevel2(i, vv, fList)
-          default:
-            Info.Println(k, "is of an unknown type")
-        }
-        i++
-    }
-}
-
-func unpackFilterLevel2(index int, filterExpression map[string]interface{}, fList *[]FilterObject) {
-    for k, v := range filterExpression {
-        switch vv := v.(type) {
-          case string:
-            Info.Println(k, "is string", vv)
-            if (k == "type") {
-                (*fList)[index].Type = vv
-            } else if (k == "value") {
-                (*fList)[index].Value = vv
-            }
-          case []interface{}:
-            Info.Println(k, "is an array:, len=",strconv.Itoa(len(vv)))
-            arrayVal, err := json.Marshal(vv)
-            if err != nil {
-		Error.Print("UnpackFilter(): JSON array encode failed. ", err)
-	    } else if (k == "value") {
-	        (*fList)[index].Value = string(arrayVal)
-	    }
-          case map[string]interface{}:
-            Info.Println(k, "is a map:")
-            opValue, err := json.Marshal(vv)
-            if err != nil {
-		Error.Print("UnpackFilter(): JSON map encode failed. ", err)
-	    } else {
-	        (*fList)[index].Value = string(opValue)
-	    }
-          default:
-            Info.Println(k, "is of an unknown type")
-        }
-    }
+// FileModTime returns the modification time of the file, or the zero time if the file cannot be accessed.
+func FileModTime(filename string) time.Time {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
 /**************** Compression reference implementation ***********************/
@@ -470,17 +393,26 @@ func readCompressedMessage(message []byte, offset int) ([]byte, int) {
 }
 
 func DecompressMessage(message []byte) []byte {
-    var message2 []byte
-    curlyBrace := make([]byte, 1)
     if (len(message) == 0) {
         return message
     }
     if (len(codeList.Code) == 0) {
         jsonToStructList(codelist, &codeList)
     }
-    if (len(pathList.Path) == 0) {
-        numOfPaths := createPathList("../vsspathlist.json") // assuming that the file is in the server directory...
-        Info.Printf("Pathlist elements=%d\n", numOfPaths)
+    refreshPathList()
+    pathListMutex.RLock()
+    defer pathListMutex.RUnlock()
+    return decompressMessage(message)
+}
+
+/**
+* decompressMessage requires that the caller holds the read lock of the path list.
+**/
+func decompressMessage(message []byte) []byte {
+    var message2 []byte
+    curlyBrace := make([]byte, 1)
+    if (len(message) == 0) {
+        return message
     }
     if (message[0] != '{') {
         curlyBrace[0] = '{'
@@ -717,19 +649,40 @@ func createPathList(fname string) int {
 		Error.Printf("Error reading %s: %s", fname, err)
 		return 0
 	}
-	jsonToStructList(string(data), &pathList)
+	var newPathList PathList
+	jsonToStructList(string(data), &newPathList)
+	pathList = newPathList
 	return len(pathList.Path)
 }
 
+/**
+* refreshPathList loads the path list at first use, and reloads it when the server core has regenerated the file after a VSS tree reload.
+* The file is checked at most every pathListCheckInterval.
+**/
+func refreshPathList() {
+	pathListMutex.Lock()
+	defer pathListMutex.Unlock()
+	if len(pathList.Path) > 0 && time.Since(pathListCheckTime) < pathListCheckInterval {
+		return
+	}
+	pathListCheckTime = time.Now()
+	modTime := FileModTime(pathListFname)
+	if len(pathList.Path) > 0 && !modTime.After(pathListModTime) {
+		return
+	}
+	pathListModTime = modTime
+	numOfPaths := createPathList(pathListFname)
+	Info.Printf("Path list elements=%d", numOfPaths)
+}
+
 func CompressMessage(message []byte) []byte {
     var message2 []byte
     if (len(codeList.Code) == 0) {
         jsonToStructList(codelist, &codeList)
     }
-    if (len(pathList.Path) == 0) {
-        numOfPaths := createPathList("../vsspathlist.json") // assuming that the file is in the server directory...
-        Info.Printf("Path list elements=%d\n", numOfPaths)
-    }
+    refreshPathList()
+    pathListMutex.RLock()
+    defer pathListMutex.RUnlock()
     var tokenState byte
     tokenState = 255
     isArray := false
@@ -789,8 +742,9 @@ Info.Printf("CompressMessage:colon added, token=%s", string(token))
     for i := 0 ; i < len(message2) ; i++ {
         Info.Printf("mess[%d]=%d,", i, message2[i])
     }
-    Info.Printf("Decompressed message=%s, length=%d", DecompressMessage(message2), len(DecompressMessage(message2)))
-    Info.Printf("Length of compressed message=%d, ratio =%d%", len(message2), len(DecompressMessage(message2))*100/len(message2))
+    decompressed := decompressMessage(message2)  // DecompressMessage would deadlock on the path list lock held here
+    Info.Printf("Decompressed message=%s, length=%d", decompressed, len(decompressed))
+    Info.Printf("Length of compressed message=%d, ratio =%d%%", len(message2), len(decompressed)*100/len(message2))
     return message2
 }
 
@@ -823,6 +777,13 @@ type PathList struct {
 }
 
 var pathList PathList
+var pathListMutex sync.RWMutex // compression is done concurrently by the client sessions
+
+var pathListFname = "../vsspathlist.json" // set from the configuration by InitConfig()
+const pathListCheckInterval = 5 * time.Second
+
+var pathListModTime time.Time
+var pathListCheckTime time.Time
 
 func jsonToStructList(jsonList string, list interface{}) {
 	err := json.Unmarshal([]byte(jsonList), list)
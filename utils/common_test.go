@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	InitLog("utils-log.txt", "./logs", false, "error")
+	pathListFname = filepath.Join(t.TempDir(), "vsspathlist.json")
+	defer func() { pathListFname = "../vsspathlist.json"; pathList = PathList{} }()
+	if err := ioutil.WriteFile(pathListFname, []byte(`{"LeafPaths":["Vehicle.Acceleration.Lateral", "Vehicle.Speed"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	message := `{"action":"get","path":"Vehicle.Speed","requestId":"232"}`
+	done := make(chan []byte)
+	go func() {
+		done <- DecompressMessage(CompressMessage([]byte(message)))
+	}()
+	select {
+	case roundTrip := <-done:
+		if string(roundTrip) != message {
+			t.Errorf("round trip of %s returned %s", message, roundTrip)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("compression deadlocked")
+	}
+}
@@ -0,0 +1,280 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/**
+* Configuration:
+* The ports, hosts, and paths used by the server components are read from one JSON configuration file,
+* given by the --config flag of the component, or else by the VISSV2_CONFIG environment variable.
+* Without a configuration file the built-in defaults below are used.
+* Relative paths in the file are resolved from the directory of the file, not from the working directory.
+* Every value can be overridden by an environment variable named VISSV2_<SECTION>_<KEY>, e.g. VISSV2_PORTS_TRANSPORTREG=9081.
+* For backwards compatibility the GEN2MODULEIP environment variable sets both hosts, unless they are set by their own variables.
+**/
+
+const ConfigEnvVarName = "VISSV2_CONFIG"
+const configEnvVarPrefix = "VISSV2_"
+
+type HostConfig struct {
+	ServerCore string `json:"serverCore"` // where the transport and service managers register
+	AtServer   string `json:"atServer"`   // where the server core validates access tokens
+}
+
+type PortConfig struct {
+	TransportReg  int `json:"transportReg"`
+	ServiceReg    int `json:"serviceReg"`
+	TransportData int `json:"transportData"` // first port of the transport manager data sessions, one port per manager
+	ServiceData   int `json:"serviceData"`   // first port of the service manager data sessions, one port per manager
+	AtServer      int `json:"atServer"`
+	AgtServer     int `json:"agtServer"`
+	WsMgr         int `json:"wsMgr"`
+	HttpMgr       int `json:"httpMgr"`
+	Admin         int `json:"admin"` // 0 disables the admin server
+}
+
+/**
+* MetricsPortConfig holds the metrics endpoint port of each component, 0 disables the endpoint.
+**/
+type MetricsPortConfig struct {
+	ServerCore int `json:"serverCore"`
+	ServiceMgr int `json:"serviceMgr"`
+	WsMgr      int `json:"wsMgr"`
+	HttpMgr    int `json:"httpMgr"`
+	MqttMgr    int `json:"mqttMgr"`
+	AtServer   int `json:"atServer"`
+	AgtServer  int `json:"agtServer"`
+}
+
+type PathConfig struct {
+	VssPathList  string `json:"vssPathList"`
+	TransportSec string `json:"transportSec"` // directory containing the transportSec.json file
+}
+
+/**
+* ServiceMgrConfig selects the vehicle data backend and the history store of the service managers, see the service manager README.
+**/
+type ServiceMgrConfig struct {
+	Backend       string `json:"backend"`       // name of a registered backend, e.g. "sqlite" or "memory"
+	DbFile        string `json:"dbFile"`        // the state storage database of the sqlite backend
+	NotifyPaths   string `json:"notifyPaths"`   // the paths of range and change notifications, NOTIFY_ALL_PATHS or NOTIFY_TRIGGER_PATHS
+	HistoryDbFile string `json:"historyDbFile"` // the database of the recorded history, kept in memory if empty
+}
+
+const (
+	NOTIFY_ALL_PATHS     = "all"
+	NOTIFY_TRIGGER_PATHS = "trigger"
+)
+
+type VissConfig struct {
+	Hosts        HostConfig        `json:"hosts"`
+	Ports        PortConfig        `json:"ports"`
+	MetricsPorts MetricsPortConfig `json:"metricsPorts"`
+	Paths        PathConfig        `json:"paths"`
+	ServiceMgr   ServiceMgrConfig  `json:"serviceMgr"`
+}
+
+// the number of data session ports reserved from the TransportData and ServiceData ports, and of metrics ports from the ServiceMgr metrics port
+const TransportDataPortRange = 10 // the max number of transport managers
+const ServiceDataPortRange = 10   // the max number of service managers
+
+/**
+* DefaultConfig returns the configuration used without a configuration file.
+* The paths are relative to the directory of a component, which is the working directory of the start scripts.
+**/
+func DefaultConfig() VissConfig {
+	return VissConfig{
+		Hosts:        HostConfig{ServerCore: "localhost", AtServer: "localhost"},
+		Ports:        PortConfig{TransportReg: 8081, ServiceReg: 8082, TransportData: 8100, ServiceData: 8200, AtServer: 8600, AgtServer: 7500, WsMgr: 8080, HttpMgr: 8888, Admin: 8090},
+		MetricsPorts: MetricsPortConfig{ServerCore: 9081, ServiceMgr: 9200, WsMgr: 9080, HttpMgr: 9888, MqttMgr: 9883, AtServer: 9600, AgtServer: 8500},
+		Paths:        PathConfig{VssPathList: "../vsspathlist.json", TransportSec: "../transport_sec/"},
+		ServiceMgr:   ServiceMgrConfig{Backend: "sqlite", DbFile: "statestorage.db", NotifyPaths: NOTIFY_ALL_PATHS, HistoryDbFile: "history.db"},
+	}
+}
+
+var Config = DefaultConfig()
+
+/**
+* LoadConfig reads the configuration file, if fname is not empty, applies the environment overrides, and validates the result.
+**/
+func LoadConfig(fname string) (VissConfig, error) {
+	config := DefaultConfig()
+	if len(fname) > 0 {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return config, fmt.Errorf("cannot read the configuration file: %s", err)
+		}
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields() // misspelled keys would otherwise silently fall back to the defaults
+		if err = decoder.Decode(&config); err != nil {
+			return config, fmt.Errorf("configuration file %s: %s", fname, err)
+		}
+		configDir := filepath.Dir(fname)
+		config.Paths.VssPathList = resolveConfigPath(configDir, config.Paths.VssPathList)
+		config.Paths.TransportSec = resolveConfigPath(configDir, config.Paths.TransportSec)
+		config.ServiceMgr.DbFile = resolveConfigPath(configDir, config.ServiceMgr.DbFile)
+		config.ServiceMgr.HistoryDbFile = resolveConfigPath(configDir, config.ServiceMgr.HistoryDbFile)
+	}
+	if value, ok := os.LookupEnv(IpEnvVarName); ok {
+		config.Hosts.ServerCore = value
+		config.Hosts.AtServer = value
+	}
+	if err := applyConfigEnv(reflect.ValueOf(&config).Elem(), configEnvVarPrefix); err != nil {
+		return config, err
+	}
+	if !strings.HasSuffix(config.Paths.TransportSec, "/") {
+		config.Paths.TransportSec += "/"
+	}
+	return config, ValidateConfig(config)
+}
+
+func resolveConfigPath(configDir string, path string) string {
+	if len(path) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+	if strings.HasSuffix(path, "/") {
+		return filepath.Join(configDir, path) + "/"
+	}
+	return filepath.Join(configDir, path)
+}
+
+/**
+* applyConfigEnv walks the configuration struct and sets the members that have a VISSV2_<SECTION>_<KEY> environment variable.
+**/
+func applyConfigEnv(value reflect.Value, prefix string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		envVarName := prefix + strings.ToUpper(value.Type().Field(i).Tag.Get("json"))
+		switch field.Kind() {
+		case reflect.Struct:
+			if err := applyConfigEnv(field, envVarName+"_"); err != nil {
+				return err
+			}
+		case reflect.Int:
+			if envValue, ok := os.LookupEnv(envVarName); ok {
+				intValue, err := strconv.Atoi(envValue)
+				if err != nil {
+					return fmt.Errorf("environment variable %s=%s is not a port number", envVarName, envValue)
+				}
+				field.SetInt(int64(intValue))
+			}
+		case reflect.String:
+			if envValue, ok := os.LookupEnv(envVarName); ok {
+				field.SetString(envValue)
+			}
+		}
+	}
+	return nil
+}
+
+/**
+* ValidateConfig checks that the hosts are set, that the port numbers are valid, and that no two ports collide,
+* including the data session port ranges. All problems are reported in the returned error.
+**/
+func ValidateConfig(config VissConfig) error {
+	var problems []string
+	if len(config.Hosts.ServerCore) == 0 {
+		problems = append(problems, "hosts.serverCore is empty")
+	}
+	if len(config.Hosts.AtServer) == 0 {
+		problems = append(problems, "hosts.atServer is empty")
+	}
+	if len(config.Paths.VssPathList) == 0 {
+		problems = append(problems, "paths.vssPathList is empty")
+	} else if !dirExists(filepath.Dir(config.Paths.VssPathList)) {
+		problems = append(problems, "the directory of paths.vssPathList="+config.Paths.VssPathList+" does not exist")
+	}
+	if len(config.ServiceMgr.Backend) == 0 {
+		problems = append(problems, "serviceMgr.backend is empty")
+	}
+	if config.ServiceMgr.NotifyPaths != NOTIFY_ALL_PATHS && config.ServiceMgr.NotifyPaths != NOTIFY_TRIGGER_PATHS {
+		problems = append(problems, "serviceMgr.notifyPaths="+config.ServiceMgr.NotifyPaths+" is not "+NOTIFY_ALL_PATHS+" or "+NOTIFY_TRIGGER_PATHS)
+	}
+	ports := []struct {
+		name      string
+		port      int
+		portRange int
+		optional  bool // 0 disables the port
+	}{
+		{"ports.transportReg", config.Ports.TransportReg, 1, false},
+		{"ports.serviceReg", config.Ports.ServiceReg, 1, false},
+		{"ports.transportData", config.Ports.TransportData, TransportDataPortRange, false},
+		{"ports.serviceData", config.Ports.ServiceData, ServiceDataPortRange, false},
+		{"ports.atServer", config.Ports.AtServer, 1, false},
+		{"ports.agtServer", config.Ports.AgtServer, 1, false},
+		{"ports.wsMgr", config.Ports.WsMgr, 1, false},
+		{"ports.httpMgr", config.Ports.HttpMgr, 1, false},
+		{"ports.admin", config.Ports.Admin, 1, true},
+		{"metricsPorts.serverCore", config.MetricsPorts.ServerCore, 1, true},
+		{"metricsPorts.serviceMgr", config.MetricsPorts.ServiceMgr, ServiceDataPortRange, true}, // one port per service manager
+		{"metricsPorts.wsMgr", config.MetricsPorts.WsMgr, 1, true},
+		{"metricsPorts.httpMgr", config.MetricsPorts.HttpMgr, 1, true},
+		{"metricsPorts.mqttMgr", config.MetricsPorts.MqttMgr, 1, true},
+		{"metricsPorts.atServer", config.MetricsPorts.AtServer, 1, true},
+		{"metricsPorts.agtServer", config.MetricsPorts.AgtServer, 1, true},
+	}
+	usedBy := map[int]string{}
+	for _, use := range ports {
+		if use.port == 0 && use.optional {
+			continue
+		}
+		if use.port < 1 || use.port+use.portRange-1 > 65535 {
+			problems = append(problems, fmt.Sprintf("%s=%d is not a valid port number", use.name, use.port))
+			continue
+		}
+		for i := 0; i < use.portRange; i++ {
+			if other, used := usedBy[use.port+i]; used {
+				problems = append(problems, fmt.Sprintf("port %d is used by both %s and %s", use.port+i, other, use.name))
+				break
+			}
+			usedBy[use.port+i] = use.name
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+/**
+* InitConfig loads the configuration for a component, from fname, or else from the file in the VISSV2_CONFIG environment variable.
+* The component is stopped with a clear message on stderr if the configuration is invalid.
+**/
+func InitConfig(fname string) {
+	if len(fname) == 0 {
+		fname = os.Getenv(ConfigEnvVarName)
+	}
+	config, err := LoadConfig(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		Error.Printf("InitConfig():%s", err)
+		os.Exit(1)
+	}
+	Config = config
+	trSecConfigPath = Config.Paths.TransportSec
+	pathListFname = Config.Paths.VssPathList
+	if len(fname) > 0 {
+		Info.Printf("InitConfig():configuration read from %s", fname)
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	os.Unsetenv(IpEnvVarName)
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "vissv2config.json")
+	data := `{"hosts":{"serverCore":"10.0.0.5"}, "ports":{"transportReg":9181}, "paths":{"vssPathList":"vsspathlist.json", "transportSec":"transport_sec"}}`
+	if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("VISSV2_PORTS_SERVICEREG", "9182")
+	defer os.Unsetenv("VISSV2_PORTS_SERVICEREG")
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %s", err)
+	}
+	if config.Hosts.ServerCore != "10.0.0.5" || config.Hosts.AtServer != "localhost" {
+		t.Errorf("unexpected hosts %+v", config.Hosts)
+	}
+	if config.Ports.TransportReg != 9181 || config.Ports.ServiceReg != 9182 || config.Ports.TransportData != 8100 {
+		t.Errorf("unexpected ports %+v", config.Ports)
+	}
+	if config.Paths.VssPathList != filepath.Join(dir, "vsspathlist.json") || config.Paths.TransportSec != filepath.Join(dir, "transport_sec")+"/" {
+		t.Errorf("paths not resolved from the configuration file directory: %+v", config.Paths)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Paths.VssPathList = "vsspathlist.json"
+	if err := ValidateConfig(config); err != nil {
+		t.Errorf("default configuration is invalid: %s", err)
+	}
+	config.Ports.HttpMgr = 8105 // within the transport manager data channel ports
+	config.MetricsPorts.AtServer = 70000
+	config.MetricsPorts.MqttMgr = 9205 // within the service manager metrics ports
+	config.Ports.Admin = 0             // disabled, no collision
+	config.MetricsPorts.WsMgr = 0
+	config.ServiceMgr.Backend = ""
+	config.ServiceMgr.NotifyPaths = "first"
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, expected := range []string{"port 8105 is used by both ports.transportData and ports.httpMgr", "port 9205 is used by both metricsPorts.serviceMgr and metricsPorts.mqttMgr", "metricsPorts.atServer=70000 is not a valid port number", "serviceMgr.backend is empty", "serviceMgr.notifyPaths=first is not all or trigger"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("missing %q in error: %s", expected, err)
+		}
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing configuration file accepted")
+	}
+}
@@ -0,0 +1,66 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package utils
+
+/**
+* VISSv2 error catalog:
+* An error response has an error object with the members number, reason, and message, where the number and reason pair is one of the errors defined in the VISSv2 spec.
+* The message describes the specific cause of the error. If it is left empty, the default message of the error is used.
+**/
+
+type ErrorCode_t struct {
+	Number  int
+	Reason  string
+	Message string // default message
+}
+
+var (
+	ErrBadRequest         = ErrorCode_t{400, "bad_request", "The server is unable to fulfil the client request because the request is malformed."}
+	ErrInvalidData        = ErrorCode_t{400, "invalid_data", "Data present in the request is invalid."}
+	ErrInvalidToken       = ErrorCode_t{401, "invalid_token", "Access token is invalid."}
+	ErrExpiredToken       = ErrorCode_t{401, "expired_token", "Access token has expired."}
+	ErrMissingToken       = ErrorCode_t{401, "missing_token", "Access token is missing."}
+	ErrForbiddenRequest   = ErrorCode_t{403, "forbidden_request", "The server refuses to carry out the request."}
+	ErrUnavailableData    = ErrorCode_t{404, "unavailable_data", "The requested data was not found."}
+	ErrTooManyRequests    = ErrorCode_t{429, "too_many_requests", "The client has sent the server too many requests in a given amount of time."}
+	ErrBadGateway         = ErrorCode_t{502, "bad_gateway", "The server was acting as a gateway or proxy and received an invalid response from an upstream server."}
+	ErrServiceUnavailable = ErrorCode_t{503, "service_unavailable", "The server is currently unable to handle the request due to a temporary overload or scheduled maintenance."}
+	ErrGatewayTimeout     = ErrorCode_t{504, "gateway_timeout", "The server did not receive a timely response from an upstream server it needed to access in order to complete the request."}
+)
+
+/**
+* ErrorObject returns the error object of an error response, which is serialized as a JSON object by FinalizeMessage().
+**/
+func ErrorObject(errorCode ErrorCode_t, message string) map[string]interface{} {
+	if len(message) == 0 {
+		message = errorCode.Message
+	}
+	return map[string]interface{}{"number": errorCode.Number, "reason": errorCode.Reason, "message": message}
+}
+
+func SetErrorResponse(reqMap map[string]interface{}, errRespMap map[string]interface{}, errorCode ErrorCode_t, message string) {
+	if reqMap["RouterId"] != nil {
+		errRespMap["RouterId"] = reqMap["RouterId"]
+	}
+	if reqMap["action"] != nil {
+		errRespMap["action"] = reqMap["action"]
+	}
+	if reqMap["requestId"] != nil {
+		errRespMap["requestId"] = reqMap["requestId"]
+	}
+	errRespMap["error"] = ErrorObject(errorCode, message)
+	errRespMap["ts"] = GetRfcTime()
+}
+
+/**
+* ErrorResponse returns an error response that is not related to a VISSv2 request, e.g. from the access token server.
+**/
+func ErrorResponse(errorCode ErrorCode_t, message string) string {
+	return FinalizeMessage(map[string]interface{}{"error": ErrorObject(errorCode, message), "ts": GetRfcTime()})
+}
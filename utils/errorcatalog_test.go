@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetErrorResponse(t *testing.T) {
+	requestMap := map[string]interface{}{"RouterId": "1?2", "action": "get", "requestId": "17", "path": "Vehicle.Speed"}
+	errorResponseMap := make(map[string]interface{})
+	SetErrorResponse(requestMap, errorResponseMap, ErrUnavailableData, "")
+	response := FinalizeMessage(errorResponseMap)
+	if !strings.Contains(response, `"error":{"message":"The requested data was not found.","number":404,"reason":"unavailable_data"}`) {
+		t.Errorf("unexpected error response %s", response)
+	}
+	if !strings.Contains(response, `"requestId":"17"`) || strings.Contains(response, "path") {
+		t.Errorf("unexpected members in error response %s", response)
+	}
+}
+
+func TestHttpErrorStatus(t *testing.T) {
+	InitLog("utils-log.txt", "./logs", false, "error")
+	for _, test := range []struct {
+		response string
+		status   int
+	}{
+		{ErrorResponse(ErrBadRequest, "Unsupported HTTP method."), 400},
+		{`{"action":"get", "requestId":"1", "value":"1", "ts":"2021-03-01T10:00:00Z"}`, 200},
+	} {
+		recorder := httptest.NewRecorder()
+		var w http.ResponseWriter = recorder
+		backendHttpAppSession(test.response, &w)
+		if recorder.Code != test.status {
+			t.Errorf("status %d for response %s", recorder.Code, test.response)
+		}
+	}
+}
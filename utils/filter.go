@@ -0,0 +1,425 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+/**
+* Typed representation of the VISSv2 filter expressions, see VISSv2 CORE, Filtering chapter.
+* A filter is either one filter expression object, or an array of them, each having the members "type" and "value".
+* The value is parsed according to the type into the corresponding struct, of which only one is set per FilterObject.
+**/
+
+const (
+	FILTER_PATHS            = "paths"
+	FILTER_TIMEBASED        = "timebased"
+	FILTER_RANGE            = "range"
+	FILTER_CHANGE           = "change"
+	FILTER_CURVELOG         = "curvelog"
+	FILTER_HISTORY          = "history"
+	FILTER_STATIC_METADATA  = "static-metadata"
+	FILTER_DYNAMIC_METADATA = "dynamic-metadata"
+)
+
+type TimebasedFilter struct {
+	Period int // in seconds
+}
+
+type RangeFilter struct {
+	LogicOp  string
+	Boundary string
+}
+
+type ChangeFilter struct {
+	LogicOp string
+	Diff    string
+}
+
+type CurvelogFilter struct {
+	MaxErr  float64
+	BufSize int
+}
+
+type HistoryFilter struct {
+	Period string // ISO8601 duration, e.g. "P2DT12H"
+}
+
+type StaticMetadataFilter struct {
+	Depth int // number of tree levels below the path, -1 = no limit
+}
+
+type DynamicMetadataFilter struct {
+	Items []string // requested metadata items, empty = all
+}
+
+type FilterObject struct {
+	Type            string
+	Paths           []string
+	Timebased       *TimebasedFilter
+	Range           []RangeFilter // all conditions must be met
+	Change          *ChangeFilter
+	Curvelog        *CurvelogFilter
+	History         *HistoryFilter
+	StaticMetadata  *StaticMetadataFilter
+	DynamicMetadata *DynamicMetadataFilter
+}
+
+var getFilterTypes = []string{FILTER_PATHS, FILTER_HISTORY, FILTER_STATIC_METADATA, FILTER_DYNAMIC_METADATA}
+var subscribeFilterTypes = []string{FILTER_PATHS, FILTER_TIMEBASED, FILTER_RANGE, FILTER_CHANGE, FILTER_CURVELOG, FILTER_HISTORY, FILTER_STATIC_METADATA, FILTER_DYNAMIC_METADATA}
+var setFilterTypes = []string{FILTER_PATHS} // a set of multiple actuators, with one value per path
+
+var logicOps = []string{"eq", "ne", "gt", "gte", "lt", "lte"}
+
+var isoDuration = regexp.MustCompile(`^P(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+
+/**
+* UnpackFilter parses the filter member of a request. An error describing the first malformed part is returned if parsing fails.
+**/
+func UnpackFilter(filter interface{}) ([]FilterObject, error) {
+	var fList []FilterObject
+	switch vv := filter.(type) {
+	case []interface{}:
+		if len(vv) == 0 {
+			return nil, errors.New("filter array is empty")
+		}
+		for i, expression := range vv {
+			expressionMap, ok := expression.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("filter array element %d is not an object", i)
+			}
+			filterObject, err := unpackFilterExpression(expressionMap)
+			if err != nil {
+				return nil, err
+			}
+			fList = append(fList, filterObject)
+		}
+	case map[string]interface{}:
+		filterObject, err := unpackFilterExpression(vv)
+		if err != nil {
+			return nil, err
+		}
+		fList = append(fList, filterObject)
+	default:
+		return nil, errors.New("filter must be an object or an array of objects")
+	}
+	for i := 0; i < len(fList); i++ {
+		for j := i + 1; j < len(fList); j++ {
+			if fList[i].Type == fList[j].Type {
+				return nil, fmt.Errorf("filter type %s occurs more than once", fList[i].Type)
+			}
+		}
+	}
+	return fList, nil
+}
+
+/**
+* ValidateFilterList checks that the filter types are allowed for the action.
+**/
+func ValidateFilterList(action string, fList []FilterObject) error {
+	allowedTypes := getFilterTypes
+	if action == "subscribe" {
+		allowedTypes = subscribeFilterTypes
+	} else if action == "set" {
+		allowedTypes = setFilterTypes
+	} else if action != "get" {
+		return fmt.Errorf("filter not allowed in %s request", action)
+	}
+	for _, filterObject := range fList {
+		if !isStringInList(filterObject.Type, allowedTypes) {
+			return fmt.Errorf("filter type %s not allowed in %s request", filterObject.Type, action)
+		}
+	}
+	return nil
+}
+
+/**
+* ValidateFilterCombination checks that the filters of a subscribe request can be combined. The filters are combined with AND semantics,
+* where a notification is triggered by the timebased or curvelog filter, or else by a value change, and range and change filters are
+* conditions that must also be satisfied. A timebased and a curvelog filter cannot be combined, as both trigger notifications.
+**/
+func ValidateFilterCombination(fList []FilterObject) error {
+	if GetFilter(fList, FILTER_TIMEBASED) != nil && GetFilter(fList, FILTER_CURVELOG) != nil {
+		return errors.New("timebased and curvelog filters cannot be combined")
+	}
+	return nil
+}
+
+/**
+* GetFilter returns the filter object of the given type, or nil if not present.
+**/
+func GetFilter(fList []FilterObject, filterType string) *FilterObject {
+	for i := 0; i < len(fList); i++ {
+		if fList[i].Type == filterType {
+			return &fList[i]
+		}
+	}
+	return nil
+}
+
+func isStringInList(value string, list []string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+func unpackFilterExpression(expression map[string]interface{}) (FilterObject, error) {
+	var filterObject FilterObject
+	filterType, ok := expression["type"].(string)
+	if !ok {
+		return filterObject, errors.New("filter type missing")
+	}
+	filterObject.Type = filterType
+	value, ok := expression["value"]
+	if !ok {
+		return filterObject, fmt.Errorf("%s filter value missing", filterType)
+	}
+	for key := range expression {
+		if key != "type" && key != "value" {
+			return filterObject, fmt.Errorf("%s filter has unknown member %s", filterType, key)
+		}
+	}
+	var err error
+	switch filterType {
+	case FILTER_PATHS:
+		filterObject.Paths, err = unpackPathsValue(value)
+	case FILTER_TIMEBASED:
+		filterObject.Timebased, err = unpackTimebasedValue(value)
+	case FILTER_RANGE:
+		filterObject.Range, err = unpackRangeValue(value)
+	case FILTER_CHANGE:
+		filterObject.Change, err = unpackChangeValue(value)
+	case FILTER_CURVELOG:
+		filterObject.Curvelog, err = unpackCurvelogValue(value)
+	case FILTER_HISTORY:
+		filterObject.History, err = unpackHistoryValue(value)
+	case FILTER_STATIC_METADATA:
+		filterObject.StaticMetadata, err = unpackStaticMetadataValue(value)
+	case FILTER_DYNAMIC_METADATA:
+		filterObject.DynamicMetadata, err = unpackDynamicMetadataValue(value)
+	default:
+		err = fmt.Errorf("unknown filter type %s", filterType)
+	}
+	return filterObject, err
+}
+
+func unpackPathsValue(value interface{}) ([]string, error) { // "x.y" or ["x.y", "z.*"]
+	switch vv := value.(type) {
+	case string:
+		if len(vv) == 0 {
+			return nil, errors.New("paths filter value is empty")
+		}
+		return []string{vv}, nil
+	case []interface{}:
+		if len(vv) == 0 {
+			return nil, errors.New("paths filter value is an empty array")
+		}
+		paths := make([]string, len(vv))
+		for i, element := range vv {
+			path, ok := element.(string)
+			if !ok || len(path) == 0 {
+				return nil, fmt.Errorf("paths filter element %d is not a non-empty string", i)
+			}
+			paths[i] = path
+		}
+		return paths, nil
+	}
+	return nil, errors.New("paths filter value must be a string or an array of strings")
+}
+
+func unpackTimebasedValue(value interface{}) (*TimebasedFilter, error) { // {"period":"X"}
+	valueMap, err := getValueObject(FILTER_TIMEBASED, value, []string{"period"})
+	if err != nil {
+		return nil, err
+	}
+	period, err := getIntegerMember(FILTER_TIMEBASED, valueMap, "period")
+	if err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		return nil, errors.New("timebased filter period must be larger than zero")
+	}
+	return &TimebasedFilter{Period: period}, nil
+}
+
+func unpackRangeValue(value interface{}) ([]RangeFilter, error) { // {"logic-op":"X", "boundary":"Y"} or an array of them
+	var elements []interface{}
+	switch vv := value.(type) {
+	case map[string]interface{}:
+		elements = []interface{}{vv}
+	case []interface{}:
+		if len(vv) == 0 || len(vv) > 2 {
+			return nil, errors.New("range filter value array must have one or two elements")
+		}
+		elements = vv
+	default:
+		return nil, errors.New("range filter value must be an object or an array of objects")
+	}
+	rangeList := make([]RangeFilter, len(elements))
+	for i, element := range elements {
+		valueMap, err := getValueObject(FILTER_RANGE, element, []string{"logic-op", "boundary"})
+		if err != nil {
+			return nil, err
+		}
+		if rangeList[i].LogicOp, err = getLogicOpMember(FILTER_RANGE, valueMap); err != nil {
+			return nil, err
+		}
+		if rangeList[i].Boundary, err = getScalarMember(FILTER_RANGE, valueMap, "boundary"); err != nil {
+			return nil, err
+		}
+	}
+	return rangeList, nil
+}
+
+func unpackChangeValue(value interface{}) (*ChangeFilter, error) { // {"logic-op":"X", "diff":"Y"}
+	valueMap, err := getValueObject(FILTER_CHANGE, value, []string{"logic-op", "diff"})
+	if err != nil {
+		return nil, err
+	}
+	var changeFilter ChangeFilter
+	if changeFilter.LogicOp, err = getLogicOpMember(FILTER_CHANGE, valueMap); err != nil {
+		return nil, err
+	}
+	if changeFilter.Diff, err = getScalarMember(FILTER_CHANGE, valueMap, "diff"); err != nil {
+		return nil, err
+	}
+	return &changeFilter, nil
+}
+
+func unpackCurvelogValue(value interface{}) (*CurvelogFilter, error) { // {"maxerr":"X", "bufsize":"Y"}
+	valueMap, err := getValueObject(FILTER_CURVELOG, value, []string{"maxerr", "bufsize"})
+	if err != nil {
+		return nil, err
+	}
+	maxErr, err := getScalarMember(FILTER_CURVELOG, valueMap, "maxerr")
+	if err != nil {
+		return nil, err
+	}
+	var curvelogFilter CurvelogFilter
+	curvelogFilter.MaxErr, err = strconv.ParseFloat(maxErr, 64)
+	if err != nil || curvelogFilter.MaxErr < 0 {
+		return nil, fmt.Errorf("curvelog filter maxerr=%s is not a non-negative number", maxErr)
+	}
+	curvelogFilter.BufSize, err = getIntegerMember(FILTER_CURVELOG, valueMap, "bufsize")
+	if err != nil {
+		return nil, err
+	}
+	if curvelogFilter.BufSize <= 0 {
+		return nil, errors.New("curvelog filter bufsize must be larger than zero")
+	}
+	return &curvelogFilter, nil
+}
+
+func unpackHistoryValue(value interface{}) (*HistoryFilter, error) { // "P2DT12H"
+	period, ok := value.(string)
+	if !ok || !isoDuration.MatchString(period) || period == "P" || period[len(period)-1] == 'T' {
+		return nil, errors.New("history filter value is not an ISO8601 duration")
+	}
+	return &HistoryFilter{Period: period}, nil
+}
+
+func unpackStaticMetadataValue(value interface{}) (*StaticMetadataFilter, error) { // "" or "depth"
+	depth, ok := value.(string)
+	if !ok {
+		if number, isNumber := value.(float64); isNumber {
+			depth = strconv.FormatFloat(number, 'f', -1, 64)
+		} else {
+			return nil, errors.New("static-metadata filter value must be empty or a tree depth")
+		}
+	}
+	if len(depth) == 0 {
+		return &StaticMetadataFilter{Depth: -1}, nil
+	}
+	depthVal, err := strconv.Atoi(depth)
+	if err != nil || depthVal < 0 {
+		return nil, fmt.Errorf("static-metadata filter depth=%s is not a non-negative integer", depth)
+	}
+	return &StaticMetadataFilter{Depth: depthVal}, nil
+}
+
+func unpackDynamicMetadataValue(value interface{}) (*DynamicMetadataFilter, error) { // "", "item", or ["item1", "item2"]
+	switch vv := value.(type) {
+	case string:
+		if len(vv) == 0 {
+			return &DynamicMetadataFilter{}, nil
+		}
+		return &DynamicMetadataFilter{Items: []string{vv}}, nil
+	case []interface{}:
+		items := make([]string, len(vv))
+		for i, element := range vv {
+			item, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("dynamic-metadata filter element %d is not a string", i)
+			}
+			items[i] = item
+		}
+		return &DynamicMetadataFilter{Items: items}, nil
+	}
+	return nil, errors.New("dynamic-metadata filter value must be a string or an array of strings")
+}
+
+func getValueObject(filterType string, value interface{}, members []string) (map[string]interface{}, error) {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s filter value must be an object", filterType)
+	}
+	for key := range valueMap {
+		if !isStringInList(key, members) {
+			return nil, fmt.Errorf("%s filter value has unknown member %s", filterType, key)
+		}
+	}
+	return valueMap, nil
+}
+
+// members are strings in VISSv2, but JSON numbers and booleans are also accepted
+func getScalarMember(filterType string, valueMap map[string]interface{}, member string) (string, error) {
+	switch vv := valueMap[member].(type) {
+	case string:
+		if len(vv) > 0 {
+			return vv, nil
+		}
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(vv), nil
+	case nil:
+		return "", fmt.Errorf("%s filter %s missing", filterType, member)
+	}
+	return "", fmt.Errorf("%s filter %s invalid", filterType, member)
+}
+
+func getIntegerMember(filterType string, valueMap map[string]interface{}, member string) (int, error) {
+	value, err := getScalarMember(filterType, valueMap, member)
+	if err != nil {
+		return 0, err
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s filter %s=%s is not an integer", filterType, member, value)
+	}
+	return intValue, nil
+}
+
+func getLogicOpMember(filterType string, valueMap map[string]interface{}) (string, error) {
+	logicOp, ok := valueMap["logic-op"].(string)
+	if !ok {
+		return "", fmt.Errorf("%s filter logic-op missing", filterType)
+	}
+	if !isStringInList(logicOp, logicOps) {
+		return "", fmt.Errorf("%s filter logic-op=%s is not one of eq, ne, gt, gte, lt, lte", filterType, logicOp)
+	}
+	return logicOp, nil
+}
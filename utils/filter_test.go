@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func unpackFilterString(t *testing.T, filter string) ([]FilterObject, error) {
+	var filterData interface{}
+	if err := json.Unmarshal([]byte(filter), &filterData); err != nil {
+		t.Fatalf("invalid test filter %s: %s", filter, err)
+	}
+	return UnpackFilter(filterData)
+}
+
+func TestUnpackFilter(t *testing.T) {
+	fList, err := unpackFilterString(t, `[{"type":"paths","value":["Row1.Pos","Row2.*"]},
+		{"type":"timebased","value":{"period":"3"}},
+		{"type":"range","value":[{"logic-op":"gt","boundary":"10"},{"logic-op":"lt","boundary":20}]},
+		{"type":"curvelog","value":{"maxerr":"0.5","bufsize":"100"}}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fList) != 4 {
+		t.Fatalf("expected 4 filter objects, got %d", len(fList))
+	}
+	if paths := GetFilter(fList, FILTER_PATHS).Paths; len(paths) != 2 || paths[1] != "Row2.*" {
+		t.Errorf("paths not parsed: %v", paths)
+	}
+	if GetFilter(fList, FILTER_TIMEBASED).Timebased.Period != 3 {
+		t.Errorf("timebased period not parsed")
+	}
+	if rangeList := GetFilter(fList, FILTER_RANGE).Range; len(rangeList) != 2 || rangeList[1].Boundary != "20" {
+		t.Errorf("range not parsed: %v", rangeList)
+	}
+	if curvelog := GetFilter(fList, FILTER_CURVELOG).Curvelog; curvelog.MaxErr != 0.5 || curvelog.BufSize != 100 {
+		t.Errorf("curvelog not parsed: %v", curvelog)
+	}
+	if err := ValidateFilterList("get", fList); err == nil {
+		t.Errorf("timebased filter accepted in get request")
+	}
+	if err := ValidateFilterList("subscribe", fList); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := ValidateFilterList("set", fList); err == nil {
+		t.Errorf("timebased filter accepted in set request")
+	}
+	if err := ValidateFilterCombination(fList); err == nil {
+		t.Errorf("timebased filter combined with curvelog filter")
+	}
+	if err := ValidateFilterCombination(fList[:3]); err != nil {
+		t.Errorf("timebased filter not combined with range filter: %s", err)
+	}
+
+	fList, err = unpackFilterString(t, `{"type":"history","value":"P2DT12H"}`)
+	if err != nil || fList[0].History.Period != "P2DT12H" {
+		t.Errorf("history not parsed, err=%v", err)
+	}
+	fList, err = unpackFilterString(t, `{"type":"static-metadata","value":"2"}`)
+	if err != nil || fList[0].StaticMetadata.Depth != 2 {
+		t.Errorf("static-metadata not parsed, err=%v", err)
+	}
+}
+
+func TestUnpackFilterMalformed(t *testing.T) {
+	malformed := []string{
+		`"range"`,
+		`[]`,
+		`{"type":"range"}`,
+		`{"type":"ranges","value":{"logic-op":"gt","boundary":"1"}}`,
+		`{"type":"range","value":{"logic-op":"greater","boundary":"1"}}`,
+		`{"type":"range","value":{"logic-op":"gt"}}`,
+		`{"type":"change","value":{"logic-op":"gt","diff":"1","extra":"2"}}`,
+		`{"type":"timebased","value":{"period":"0"}}`,
+		`{"type":"timebased","value":{"period":"fast"}}`,
+		`{"type":"curvelog","value":{"maxerr":"-1","bufsize":"10"}}`,
+		`{"type":"history","value":"2 days"}`,
+		`{"type":"paths","value":[]}`,
+		`{"type":"static-metadata","value":"-1"}`,
+		`[{"type":"paths","value":"A"},{"type":"paths","value":"B"}]`,
+	}
+	for _, filter := range malformed {
+		if _, err := unpackFilterString(t, filter); err == nil {
+			t.Errorf("malformed filter accepted: %s", filter)
+		}
+	}
+}
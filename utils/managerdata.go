@@ -17,7 +17,7 @@ import (
 
 var requestTag int
 
-var trSecConfigPath string = "../transport_sec/"  // relative path to the directory containing the transportSec.json file
+var trSecConfigPath string = "../transport_sec/"  // path to the directory containing the transportSec.json file, set from the configuration by InitConfig()
 type SecConfig struct {
     TransportSec string  `json:"transportSec"`// "yes" or "no"
     SecPort string       `json:"secPort"`// port number
@@ -55,11 +55,18 @@ func backendHttpAppSession(message string, w *http.ResponseWriter) {
             delete(responseMap, "requestId")
         }
         response := FinalizeMessage(responseMap)
+        status := http.StatusOK
+        if errorObject, ok := responseMap["error"].(map[string]interface{}); ok {
+            if number, ok := errorObject["number"].(float64); ok {
+                status = int(number)  // the HTTP status code is the error number
+            }
+        }
 
 	resp := []byte(response)
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
 	(*w).Header().Set("Access-Control-Allow-Headers", "*")
 	(*w).Header().Set("Content-Length", strconv.Itoa(len(resp)))
+	(*w).WriteHeader(status)
 	written, err := (*w).Write(resp)
 	if err != nil {
 		Error.Printf("HTTP manager error on response write.Written bytes=%d. Error=%s\n", written, err.Error())
@@ -76,17 +83,27 @@ func FrontendWSdataSession(conn *websocket.Conn, clientChannel chan string, back
 		}
 		Info.Printf("%s request: %s \n", conn.RemoteAddr(), string(msg))
 
+		start := time.Now()
 		clientChannel <- string(msg) // forward to mgr hub,
 		message := <-clientChannel   //  and wait for response
+		ObserveRequest(string(msg), message, start)
 
 		backendChannel <- message
 	}
 }
 
-func BackendWSdataSession(conn *websocket.Conn, backendChannel chan string) {
+/**
+* BackendWSdataSession writes the messages of the backend channel to the WS session until done is closed, or a write fails.
+**/
+func BackendWSdataSession(conn *websocket.Conn, backendChannel chan string, done chan struct{}) {
 	defer conn.Close()
 	for {
-		message := <-backendChannel
+		var message string
+		select {
+		case message = <-backendChannel:
+		case <-done:
+			return
+		}
 
 		Info.Printf("Service:BackendWSdataSession(): message received=%s\n", message)
 		// Write message back to server core
@@ -136,6 +153,7 @@ func frontendHttpAppSession(w http.ResponseWriter, req *http.Request, clientChan
         }
 	requestMap["requestId"] = strconv.Itoa(requestTag)
 	requestTag++
+	start := time.Now()
 	switch req.Method {
 	case "OPTIONS":
                 fallthrough  // should work for POST also...
@@ -148,11 +166,13 @@ func frontendHttpAppSession(w http.ResponseWriter, req *http.Request, clientChan
 	default:
 //		http.Error(w, "400 Unsupported method", http.StatusBadRequest)
 		Warning.Printf("Only GET and POST methods are supported.")
- 	        backendHttpAppSession(`{"error": "400", "reason": "Bad request", "message":"Unsupported HTTP method"}`, &w)
+ 	        backendHttpAppSession(ErrorResponse(ErrBadRequest, "Unsupported HTTP method."), &w)
 		return
 	}
-	clientChannel <- AddKeyValue(FinalizeMessage(requestMap), queryKey, queryValue) // forward to mgr hub,
-	response := <-clientChannel                   //  and wait for response
+	request := AddKeyValue(FinalizeMessage(requestMap), queryKey, queryValue)
+	clientChannel <- request    // forward to mgr hub,
+	response := <-clientChannel //  and wait for response
+	ObserveRequest(request, response, start)
 
 	backendHttpAppSession(response, &w)
 }
@@ -172,7 +192,7 @@ func InitDataSession(muxServer *http.ServeMux, regData RegData) (dataConn *webso
 * Registers with servercore as WebSocket protocol manager, and stores response in regData
 **/
 func RegisterAsTransportMgr(regData *RegData, protocol string) {
-	url := "http://" + GetServerIP() + ":8081/transport/reg"
+	url := "http://" + GetServerIP() + ":" + strconv.Itoa(Config.Ports.TransportReg) + "/transport/reg"
 
 	data := []byte(`{"protocol": "` + protocol + `"}`)
 
@@ -184,7 +204,7 @@ func RegisterAsTransportMgr(regData *RegData, protocol string) {
 	// Set headers
 	req.Header.Set("Access-Control-Allow-Origin", "*")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Host", GetServerIP()+":8081")
+	req.Header.Set("Host", GetServerIP()+":"+strconv.Itoa(Config.Ports.TransportReg))
 
 	// Set client timeout
 	client := &http.Client{Timeout: time.Second * 10}
@@ -216,6 +236,8 @@ func RegisterAsTransportMgr(regData *RegData, protocol string) {
 
 func frontendWSAppSession(conn *websocket.Conn, clientChannel chan string, clientBackendChannel chan string, isCompressProtocol bool) {
 	defer conn.Close()
+	wsSessionGauge.Inc()
+	defer wsSessionGauge.Dec()
 	for {
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
@@ -229,8 +251,10 @@ func frontendWSAppSession(conn *websocket.Conn, clientChannel chan string, clien
 		payload := string(msg)
 		Info.Printf("%s request: %s, len=%d\n", conn.RemoteAddr(), payload, len(payload))
 
+		start := time.Now()
 		clientChannel <- payload    // forward to mgr hub,
 		response := <-clientChannel //  and wait for response
+		ObserveRequest(payload, response, start)
 
 		clientBackendChannel <- response
 	}
@@ -324,12 +348,13 @@ Info.Printf("InitClientServer():secConfig.TransportSec=%s", secConfig.TransportS
  	    Info.Printf("HTTPS:CerOpt=%s", secConfig.ServerCertOpt)
 	    Error.Fatal(server.ListenAndServeTLS(trSecConfigPath + secConfig.ServerSecPath + "server.crt", trSecConfigPath + secConfig.ServerSecPath + "server.key"))
 	} else {
-	    Error.Fatal(http.ListenAndServe(":8888", muxServer))
+	    Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(Config.Ports.HttpMgr), muxServer))
 	}
 }
 
 func (server WsServer) InitClientServer(muxServer *http.ServeMux, serverIndex *int) {
 	*serverIndex = 0
+	wsSessionGauge.Set(0)
 	appClientHandler := WsChannel{server.ClientBackendChannel, serverIndex}.makeappClientHandler(AppClientChan)
 	muxServer.HandleFunc("/", appClientHandler)
 Info.Printf("InitClientServer():secConfig.TransportSec=%s", secConfig.TransportSec)
@@ -343,7 +368,7 @@ Info.Printf("InitClientServer():secConfig.TransportSec=%s", secConfig.TransportS
  	    Info.Printf("HTTPS:CerOpt=%s", secConfig.ServerCertOpt)
 	    Error.Fatal(server.ListenAndServeTLS(trSecConfigPath + secConfig.ServerSecPath + "server.crt", trSecConfigPath + secConfig.ServerSecPath + "server.key"))
 	} else {
-	    Error.Fatal(http.ListenAndServe(":8080", muxServer))
+	    Error.Fatal(http.ListenAndServe(":"+strconv.Itoa(Config.Ports.WsMgr), muxServer))
 	}
 }
 
@@ -367,7 +392,7 @@ func getTLSConfig(host string, caCertFile string, certOpt tls.ClientAuthType) *t
 	if certOpt > tls.RequestClientCert {
 		caCert, err = ioutil.ReadFile(caCertFile)
 		if err != nil {
-			Error.Printf("Error opening cert file", caCertFile, ", error ", err)
+			Error.Printf("Error opening cert file %s, error %s", caCertFile, err)
 			return nil
 		}
 		caCertPool = x509.NewCertPool()
@@ -415,6 +440,7 @@ func (wsCoreSocketSession WsWSsession) TransportHubFrontendWSsession(dataConn *w
 		Info.Printf("Server hub: WS response from server core:%s\n", string(response))
 		trimmedResponse, clientId := RemoveInternalData(string(response))
 		if strings.Contains(trimmedResponse, "\"subscription\"") {
+			CountNotification()
 			wsCoreSocketSession.ClientBackendChannel[clientId] <- trimmedResponse //subscription notification
 		} else {
 			appClientChannel[clientId] <- trimmedResponse
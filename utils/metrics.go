@@ -0,0 +1,396 @@
+/**
+* (C) 2021 Geotab Inc
+*
+* All files and artifacts in the repository at https://github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl
+* are licensed under the provisions of the license provided by the LICENSE file in this repository.
+*
+**/
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+* Runtime metrics:
+* Each server component exposes its metrics at /metrics in the Prometheus text format, on the port set in the metricsPorts section of the configuration, see config.go.
+* Metrics are created by NewCounter, NewGauge, NewHistogram, and NewGaugeFunc, which register them in the process wide registry.
+* A metric has a sample per combination of label values. Metrics without samples are not exposed,
+* so metrics defined here that a component does not use are not part of its output.
+**/
+
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricFamily interface {
+	write(buffer *bytes.Buffer)
+}
+
+var metricsRegistry []metricFamily
+var metricsRegistryMutex sync.Mutex
+
+func registerMetric(family metricFamily) {
+	metricsRegistryMutex.Lock()
+	metricsRegistry = append(metricsRegistry, family)
+	metricsRegistryMutex.Unlock()
+}
+
+type metricDesc struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (desc *metricDesc) labelKey(labelValues []string) (string, bool) {
+	if len(labelValues) != len(desc.labelNames) {
+		Error.Printf("metric %s:%d label values given, expected %d", desc.name, len(labelValues), len(desc.labelNames))
+		return "", false
+	}
+	return strings.Join(labelValues, "\xff"), true
+}
+
+func (desc *metricDesc) writeHeader(buffer *bytes.Buffer) {
+	buffer.WriteString("# HELP " + desc.name + " " + desc.help + "\n")
+	buffer.WriteString("# TYPE " + desc.name + " " + desc.metricType + "\n")
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatLabels(labelNames []string, labelKey string, extraName string, extraValue string) string {
+	var labels []string
+	if len(labelNames) > 0 {
+		labelValues := strings.Split(labelKey, "\xff")
+		for i, labelName := range labelNames {
+			labels = append(labels, labelName+`="`+escapeLabelValue(labelValues[i])+`"`)
+		}
+	}
+	if len(extraName) > 0 {
+		labels = append(labels, extraName+`="`+extraValue+`"`)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(samples map[string]float64) []string {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+* valueMetric is the common implementation of counters and gauges.
+**/
+type valueMetric struct {
+	metricDesc
+	mutex   sync.Mutex
+	samples map[string]float64
+}
+
+func newValueMetric(name string, help string, metricType string, labelNames []string) *valueMetric {
+	metric := &valueMetric{metricDesc: metricDesc{name, help, metricType, labelNames}, samples: map[string]float64{}}
+	registerMetric(metric)
+	return metric
+}
+
+func (metric *valueMetric) update(labelValues []string, updateFunc func(float64) float64) {
+	if key, ok := metric.labelKey(labelValues); ok {
+		metric.mutex.Lock()
+		metric.samples[key] = updateFunc(metric.samples[key])
+		metric.mutex.Unlock()
+	}
+}
+
+func (metric *valueMetric) write(buffer *bytes.Buffer) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	if len(metric.samples) == 0 {
+		return
+	}
+	metric.writeHeader(buffer)
+	for _, key := range sortedKeys(metric.samples) {
+		buffer.WriteString(metric.name + formatLabels(metric.labelNames, key, "", "") + " " + formatFloat(metric.samples[key]) + "\n")
+	}
+}
+
+type Counter struct {
+	metric *valueMetric
+}
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{newValueMetric(name, help, "counter", labelNames)}
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	counter.metric.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+type Gauge struct {
+	metric *valueMetric
+}
+
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{newValueMetric(name, help, "gauge", labelNames)}
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.metric.update(labelValues, func(float64) float64 { return value })
+}
+
+func (gauge *Gauge) Add(value float64, labelValues ...string) {
+	gauge.metric.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+func (gauge *Gauge) Inc(labelValues ...string) {
+	gauge.Add(1, labelValues...)
+}
+
+func (gauge *Gauge) Dec(labelValues ...string) {
+	gauge.Add(-1, labelValues...)
+}
+
+/**
+* Delete removes the sample of the label values, e.g. when the signal it describes is no longer recorded.
+**/
+func (gauge *Gauge) Delete(labelValues ...string) {
+	if key, ok := gauge.metric.labelKey(labelValues); ok {
+		gauge.metric.mutex.Lock()
+		delete(gauge.metric.samples, key)
+		gauge.metric.mutex.Unlock()
+	}
+}
+
+type gaugeFunc struct {
+	metricDesc
+	function func() float64
+}
+
+/**
+* NewGaugeFunc registers a gauge without labels whose value is read by calling the function at each scrape.
+**/
+func NewGaugeFunc(name string, help string, function func() float64) {
+	registerMetric(&gaugeFunc{metricDesc{name, help, "gauge", nil}, function})
+}
+
+func (metric *gaugeFunc) write(buffer *bytes.Buffer) {
+	metric.writeHeader(buffer)
+	buffer.WriteString(metric.name + " " + formatFloat(metric.function()) + "\n")
+}
+
+type histogramSample struct {
+	bucketCounts []uint64 // not cumulative, the last element counts the observations above the highest bucket
+	sum          float64
+	count        uint64
+}
+
+type Histogram struct {
+	metricDesc
+	buckets []float64
+	mutex   sync.Mutex
+	samples map[string]*histogramSample
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{metricDesc: metricDesc{name, help, "histogram", labelNames}, buckets: buckets, samples: map[string]*histogramSample{}}
+	registerMetric(histogram)
+	return histogram
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	key, ok := histogram.labelKey(labelValues)
+	if !ok {
+		return
+	}
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	sample := histogram.samples[key]
+	if sample == nil {
+		sample = &histogramSample{bucketCounts: make([]uint64, len(histogram.buckets)+1)}
+		histogram.samples[key] = sample
+	}
+	sample.bucketCounts[sort.SearchFloat64s(histogram.buckets, value)]++ // the first bucket having an upper bound >= value
+	sample.sum += value
+	sample.count++
+}
+
+func (histogram *Histogram) write(buffer *bytes.Buffer) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	if len(histogram.samples) == 0 {
+		return
+	}
+	histogram.writeHeader(buffer)
+	keys := make([]string, 0, len(histogram.samples))
+	for key := range histogram.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample := histogram.samples[key]
+		var cumulativeCount uint64
+		for i, bucketCount := range sample.bucketCounts {
+			cumulativeCount += bucketCount
+			upperBound := math.Inf(1)
+			if i < len(histogram.buckets) {
+				upperBound = histogram.buckets[i]
+			}
+			buffer.WriteString(histogram.name + "_bucket" + formatLabels(histogram.labelNames, key, "le", formatFloat(upperBound)) + " " + strconv.FormatUint(cumulativeCount, 10) + "\n")
+		}
+		labels := formatLabels(histogram.labelNames, key, "", "")
+		buffer.WriteString(histogram.name + "_sum" + labels + " " + formatFloat(sample.sum) + "\n")
+		buffer.WriteString(histogram.name + "_count" + labels + " " + strconv.FormatUint(sample.count, 10) + "\n")
+	}
+}
+
+func WriteMetrics(writer io.Writer) error {
+	var buffer bytes.Buffer
+	metricsRegistryMutex.Lock()
+	for _, family := range metricsRegistry {
+		family.write(&buffer)
+	}
+	metricsRegistryMutex.Unlock()
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+func MetricsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(w)
+}
+
+/**
+* ServeMetrics serves /metrics on the port. A port number of 0 disables the metrics endpoint.
+**/
+func ServeMetrics(portNum int) {
+	if portNum == 0 {
+		return
+	}
+	muxServer := http.NewServeMux()
+	muxServer.HandleFunc("/metrics", MetricsHandler)
+	Info.Printf("ServeMetrics(): :%d/metrics", portNum)
+	err := http.ListenAndServe(":"+strconv.Itoa(portNum), muxServer)
+	Error.Printf("ServeMetrics():metrics server on port %d failed, err=%s", portNum, err) // metrics are not essential, the component keeps running
+}
+
+/**
+* Metrics shared by the server components.
+**/
+var requestCounter = NewCounter("vissv2_requests_total", "Requests served, by action and result, where the result is ok or the error reason.", "action", "result")
+var requestDuration = NewHistogram("vissv2_request_duration_seconds", "Time from request reception to response, by action.", DefaultLatencyBuckets, "action")
+var notificationCounter = NewCounter("vissv2_notifications_total", "Subscription notifications sent.")
+var tokenValidationCounter = NewCounter("vissv2_token_validations_total", "Access token validations, by result.", "result")
+var wsSessionGauge = NewGauge("vissv2_ws_sessions", "Active WebSocket client sessions.")
+
+// the action label values of VISSv2 messages, other actions sent by clients are counted as "other", so that they cannot add label values without limit
+var messageActions = map[string]bool{"get": true, "set": true, "subscribe": true, "unsubscribe": true, "subscription": true}
+
+/**
+* MessageResult returns the action of a request or response message, and the error reason if it is an error response, else "ok".
+* The action is "unknown" if the message has none, and "other" if it is not a VISSv2 action.
+**/
+func MessageResult(message string) (string, string) {
+	var fields struct {
+		Action string `json:"action"`
+		Error  struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	json.Unmarshal([]byte(message), &fields) // a message that cannot be decoded gives an unknown action
+	action := fields.Action
+	if len(action) == 0 {
+		action = "unknown"
+	} else if !messageActions[action] {
+		action = "other"
+	}
+	result := "ok"
+	if len(fields.Error.Reason) > 0 {
+		result = fields.Error.Reason
+	} else if strings.Contains(message, `"error"`) {
+		result = "error"
+	}
+	return action, result
+}
+
+/**
+* ObserveRequest counts the request by the action of the request and the result of the response, and observes the response time.
+**/
+func ObserveRequest(request string, response string, start time.Time) {
+	action, _ := MessageResult(request)
+	_, result := MessageResult(response)
+	ObserveRequestResult(action, result, start)
+}
+
+/**
+* ObserveRequestResult is used for requests that are not VISSv2 requests, e.g. access token requests.
+**/
+func ObserveRequestResult(action string, result string, start time.Time) {
+	requestCounter.Inc(action, result)
+	requestDuration.Observe(time.Since(start).Seconds(), action)
+}
+
+/**
+* CountResponse counts a response whose request reception time is not known.
+**/
+func CountResponse(response string) {
+	action, result := MessageResult(response)
+	requestCounter.Inc(action, result)
+}
+
+func CountNotification() {
+	notificationCounter.Inc()
+}
+
+/**
+* CountTokenValidation counts the outcome of an access token validation, given as the validation code, see getTokenErrorMessage() in the server core.
+**/
+func CountTokenValidation(validation int) {
+	tokenValidationCounter.Inc(TokenValidationResult(validation))
+}
+
+func TokenValidationResult(validation int) string {
+	errorBits := -validation
+	switch {
+	case validation == 0:
+		return "ok"
+	case validation < 0 && errorBits&128 != 0:
+		return "error"
+	case errorBits&(4|8) != 0:
+		return "forbidden"
+	case errorBits&2 != 0:
+		return "invalid_signature"
+	case errorBits&32 != 0:
+		return "expired"
+	case errorBits&16 != 0:
+		return "not_yet_valid"
+	case errorBits == 1:
+		return "missing"
+	}
+	return "error"
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	InitLog("utils-log.txt", "./logs", false, "error")
+	counter := NewCounter("test_requests_total", "Test requests.", "action", "result")
+	counter.Inc("get", "ok")
+	counter.Add(2, "set", `bad"quote`)
+	counter.Inc("get") // wrong number of label values, ignored
+	gauge := NewGauge("test_sessions", "Test sessions.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	NewGauge("test_unused", "Not exposed as it has no samples.")
+	histogram := NewHistogram("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "action")
+	histogram.Observe(0.05, "get")
+	histogram.Observe(0.1, "get")
+	histogram.Observe(5, "get")
+
+	var buffer bytes.Buffer
+	WriteMetrics(&buffer)
+	output := buffer.String()
+	for _, expected := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{action="get",result="ok"} 1` + "\n",
+		`test_requests_total{action="set",result="bad\"quote"} 2` + "\n",
+		"# TYPE test_sessions gauge\ntest_sessions 1\n",
+		`test_duration_seconds_bucket{action="get",le="0.1"} 2` + "\n",
+		`test_duration_seconds_bucket{action="get",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{action="get",le="+Inf"} 3` + "\n",
+		`test_duration_seconds_sum{action="get"} 5.15` + "\n",
+		`test_duration_seconds_count{action="get"} 3` + "\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("missing %q in output:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "test_unused") {
+		t.Errorf("metric without samples exposed")
+	}
+}
+
+func TestMessageResult(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		action  string
+		result  string
+	}{
+		{`{"action":"get", "requestId":"1", "value":"1", "ts":"2021-03-01T10:00:00Z"}`, "get", "ok"},
+		{ErrorResponse(ErrExpiredToken, ""), "unknown", "expired_token"},
+		{`{"action":"subscribe", "error":{"number":"400", "reason":"bad_request"}}`, "subscribe", "bad_request"},
+		{"not json", "unknown", "ok"},
+		{`{"action":"x1234", "requestId":"1"}`, "other", "ok"}, // a client defined action is not a label value
+	} {
+		if action, result := MessageResult(test.message); action != test.action || result != test.result {
+			t.Errorf("MessageResult(%s)=%s, %s", test.message, action, result)
+		}
+	}
+	for validation, result := range map[int]string{0: "ok", -1: "missing", -2: "invalid_signature", -4: "forbidden", -8: "forbidden", -16: "not_yet_valid", -2 - 32: "invalid_signature", -32: "expired", -128: "error"} {
+		if TokenValidationResult(validation) != result {
+			t.Errorf("TokenValidationResult(%d)=%s, expected %s", validation, TokenValidationResult(validation), result)
+		}
+	}
+}
@@ -9,7 +9,7 @@
 package main
 
 import (
-	//    "fmt"
+	"fmt"
 	"os"
 	"os/exec"
 	"flag"
@@ -23,7 +23,6 @@ import (
 	"github.com/MEAE-GOT/W3C_VehicleSignalInterfaceImpl/utils"
 )
 
-const portNum  = 8080 // WS mgr portnum
 const urlPath  = ""
 const subscribeCommand  = `{"action":"subscribe", "path":"Vehicle/Cabin/Door/Count", "filter":"$intervalEQ5", "requestId":"999"}`
 const subscribePeriod = 5  // set to value X set in "$intervalEQX" above
@@ -211,8 +210,9 @@ func main() {
 		Help:     "changes log output level",
 		Default:  "info"})
 	ipAddr := parser.String("", "ip", &argparse.Options{
-		Required: true,
-		Help:     "Ip adress "})
+		Required: false,
+		Help:     "Ip adress, replaces hosts.serverCore of the configuration"})
+	configFile := parser.String("", "config", &argparse.Options{Required: false, Help: "configuration file, replaces the file in the VISSV2_CONFIG environment variable"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -220,13 +220,13 @@ func main() {
 		fmt.Print(parser.Usage(err))
 	}
 
-	if len(*ipAddr) < 10 {
-		utils.Error.Println("Program must be provided server IP address as input.")
-		return
-	}
 	triggerChan := make(chan string)
 	utils.InitLog("watchdog-log.txt", "./logs", *logFile, *logLevel)
-	addr = flag.String("addr", *ipAddr+":"+strconv.Itoa(portNum), "http service address")
+	utils.InitConfig(*configFile)
+	if len(*ipAddr) == 0 {
+		*ipAddr = utils.Config.Hosts.ServerCore
+	}
+	addr = flag.String("addr", *ipAddr+":"+strconv.Itoa(utils.Config.Ports.WsMgr), "http service address") // the WS mgr
 	dataConn := initSubscribeSession(addr)
 	if dataConn == nil {
 		return